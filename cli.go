@@ -1,159 +1,559 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
-	"path/filepath"
+	"strings"
+
+	"github.com/Disquse/RGLExtractor/keys"
+	"github.com/Disquse/RGLExtractor/launcher"
+	"github.com/Disquse/RGLExtractor/rpf"
 )
 
-const (
-	cmdInvalid         = 0
-	cmdExtractLauncher = 1
-	cmdDecryptTitles   = 2
+// Value of --rgl that searches for the installation
+const autoLauncherPath = "auto"
+
+var (
+	// ErrNoLauncherPath is returned when --rgl is missing
+	ErrNoLauncherPath = errors.New("launcher path is not specified")
+
+	// ErrNoPackSource is returned when neither --rgl nor --rpf is set
+	ErrNoPackSource = errors.New("either launcher path or pack file path must be specified")
+
+	// ErrManyPackSources is returned when both --rgl and --rpf are set
+	ErrManyPackSources = errors.New("launcher path and pack file path can't be used together")
+
+	// ErrManyKeySources is returned when both --key and --key-file are set
+	ErrManyKeySources = errors.New("key and key file can't be used together")
+
+	// ErrNoImportKey is returned when --import is set without a key
+	ErrNoImportKey = errors.New("key or key file must be specified to import it")
+
+	// ErrNoTitlesPath is returned when --titles is missing
+	ErrNoTitlesPath = errors.New("titles path is not specified")
+
+	// ErrNoOutPath is returned when --out is missing
+	ErrNoOutPath = errors.New("output path is not specified")
+
+	// ErrNoEntryPath is returned when --entry is missing
+	ErrNoEntryPath = errors.New("entry path is not specified")
+
+	// ErrNotDirectory is returned when a path must be an existing directory
+	ErrNotDirectory = errors.New("path is not a directory")
+
+	// ErrIsDirectory is returned when a path must be a file
+	ErrIsDirectory = errors.New("path is a directory")
+
+	// ErrUnknownCommand is returned for a command that does not exist
+	ErrUnknownCommand = errors.New("unknown command")
+
+	// ErrFormatStdout is returned when both content and records go to stdout
+	ErrFormatStdout = errors.New("structured output can't be used while writing entry to stdout")
 )
 
 type cliParams struct {
-	cmdType    int
-	rglPath    string
-	outPath    string
-	titlesPath string
+	rglPath     string
+	rpfPath     string
+	keyHex      string
+	keyFilePath string
+	cachePath   string
+	exportPath  string
+	importKey   bool
+	outPath     string
+	titlesPath  string
+	ngKeysPath  string
+	recursive   bool
+	listTree    bool
+	entryPath   string
+	filter      *rpf.EntryFilter
+	format      string
+	output      *outputWriter
+	keepGoing   bool
+	progress    bool
+
+	// Raw filter flags, turned into filter during validation
+	includes   stringList
+	excludes   stringList
+	extensions stringList
+	minSize    int64
+	maxSize    int64
+}
+
+// Value of a flag that can be repeated
+type stringList []string
+
+func (sl *stringList) String() string {
+	return strings.Join(*sl, ",")
+}
+
+func (sl *stringList) Set(value string) error {
+	*sl = append(*sl, value)
+	return nil
+}
+
+// A subcommand with its own flags and validation
+type cliCommand struct {
+	name        string
+	usage       string
+	description string
+	setup       func(flags *flag.FlagSet, params *cliParams)
+	validate    func(params *cliParams) error
+	run         func(params *cliParams) error
 }
 
 const (
-	helpCommand = "`.\\RGLExtractor.exe --rgl \"C:\\Program Files\\Rockstar Games\\Launcher\" --out \"C:\\Launcher_rpf\"`" +
-		"\nor\n`.\\RGLExtractor.exe --titles \"C:\\Launcher_rpf\" --out \"C:\\titles_rgl\"`"
+	appName = "RGLExtractor"
 )
 
-func parseParams() *cliParams {
-	rglPath := flag.String("rgl", "", "Path to root folder of RGL installation")
-	outPath := flag.String("out", "", "Path to output folder for extraction")
-	titlesPath := flag.String("titles", "", "Path to folder with title.rgl files to decrypt")
+var cliCommands = []*cliCommand{
+	{
+		name:        "extract",
+		usage:       "extract (--rgl <path> | --rpf <file>) --out <path> [--recursive] [filters]",
+		description: "Extract every pack of RGL installation, or a single pack, into a folder",
+		setup: func(flags *flag.FlagSet, params *cliParams) {
+			addLauncherFlags(flags, params)
+			addFilterFlags(flags, params)
+			addFormatFlag(flags, params)
+			addKeepGoingFlag(flags, params)
+			flags.StringVar(&params.outPath, "out", "", "Path to output folder for extraction")
+			flags.BoolVar(&params.recursive, "recursive", false, "Extract content of packs nested inside other packs")
+			flags.BoolVar(&params.progress, "progress", false, "Draw a progress bar on stderr instead of printing every entry")
+		},
+		validate: func(params *cliParams) error {
+			if err := validatePackSource(params); err != nil {
+				return err
+			}
+
+			if err := validateOutDirectory(params); err != nil {
+				return err
+			}
+
+			return buildFilter(params)
+		},
+		run: extractLauncher,
+	},
+	{
+		name:        "titles",
+		usage:       "titles --titles <path> --out <path> [--rgl <path>]",
+		description: "Decrypt every title.rgl file found in a folder",
+		setup: func(flags *flag.FlagSet, params *cliParams) {
+			addFormatFlag(flags, params)
+			addKeepGoingFlag(flags, params)
+			flags.StringVar(&params.titlesPath, "titles", "", "Path to folder with title.rgl files to decrypt")
+			flags.StringVar(&params.outPath, "out", "", "Path to output folder for decrypted titles")
+			flags.StringVar(&params.rglPath, "rgl", "", "Path to root folder of RGL installation or \"auto\", to search launcher.exe for the title key")
+			addCacheFlag(flags, params)
+		},
+		validate: func(params *cliParams) error {
+			if params.titlesPath == "" {
+				return ErrNoTitlesPath
+			}
 
-	flag.Parse()
+			if err := validateDirectory(params.titlesPath); err != nil {
+				return fmt.Errorf("invalid titles path \"%s\": %w", params.titlesPath, err)
+			}
 
-	cmdType := cmdInvalid
+			if params.rglPath != "" {
+				if err := validateLauncherPath(params); err != nil {
+					return err
+				}
+			}
 
-	if *titlesPath != "" {
-		cmdType = cmdDecryptTitles
+			return validateOutDirectory(params)
+		},
+		run: decryptTitles,
+	},
+	{
+		name:        "list",
+		usage:       "list (--rgl <path> | --rpf <file>) [--tree]",
+		description: "List content of every pack of RGL installation, or of a single pack",
+		setup: func(flags *flag.FlagSet, params *cliParams) {
+			addLauncherFlags(flags, params)
+			addFormatFlag(flags, params)
+			flags.BoolVar(&params.listTree, "tree", false, "List content of packs as a tree instead of a table")
+		},
+		validate: validatePackSource,
+		run:      listLauncher,
+	},
+	{
+		name:        "info",
+		usage:       "info (--rgl <path> | --rpf <file>)",
+		description: "Show header information of every pack of RGL installation, or of a single pack",
+		setup: func(flags *flag.FlagSet, params *cliParams) {
+			addLauncherFlags(flags, params)
+			addFormatFlag(flags, params)
+		},
+		validate: validatePackSource,
+		run:      showInfo,
+	},
+	{
+		name:        "cat",
+		usage:       "cat (--rgl <path> | --rpf <file>) --entry <path> [--out <file>]",
+		description: "Extract a single pack entry into a file or stdout",
+		setup: func(flags *flag.FlagSet, params *cliParams) {
+			addLauncherFlags(flags, params)
+			addFormatFlag(flags, params)
+			flags.StringVar(&params.entryPath, "entry", "", "Path of a pack entry, with or without the pack name, may go into nested packs")
+			flags.StringVar(&params.outPath, "out", "-", "Path to output file, \"-\" writes to stdout")
+		},
+		validate: func(params *cliParams) error {
+			if err := validatePackSource(params); err != nil {
+				return err
+			}
 
-		pathStat, err := os.Stat(*titlesPath)
-		if err == os.ErrNotExist || !pathStat.IsDir() {
-			fmt.Printf("Invalid titles path: \"%s\"\n", *rglPath)
-			return nil
-		}
-	} else if *rglPath != "" {
-		cmdType = cmdExtractLauncher
+			if params.entryPath == "" {
+				return ErrNoEntryPath
+			}
+
+			if params.outPath == "" {
+				return ErrNoOutPath
+			}
+
+			if params.outPath == "-" && params.format != "" && params.format != formatText {
+				return ErrFormatStdout
+			}
 
-		pathStat, err := os.Stat(*rglPath)
-		if err == os.ErrNotExist || !pathStat.IsDir() {
-			fmt.Printf("Invalid launcher path: \"%s\"\n", *rglPath)
 			return nil
-		}
-	} else {
-		fmt.Printf("You need to specify more arguments. Example:\n%s\n", helpCommand)
-		return nil
-	}
+		},
+		run: extractEntry,
+	},
+	{
+		name:        "keys",
+		usage:       "keys (--rgl <path> | --key <hex> | --key-file <file>) [--export <file>] [--import]",
+		description: "Show the pack encryption key found in launcher.exe or given explicitly, export it or import it into the cache",
+		setup: func(flags *flag.FlagSet, params *cliParams) {
+			flags.StringVar(&params.rglPath, "rgl", "", "Path to root folder of RGL installation, \"auto\" to search for it")
+			flags.StringVar(&params.keyHex, "key", "", "AES key as a hex string, instead of searching launcher.exe")
+			flags.StringVar(&params.keyFilePath, "key-file", "", "Path to a file with AES key, raw or as a hex string")
+			flags.StringVar(&params.exportPath, "export", "", "Write the key into a key file")
+			flags.BoolVar(&params.importKey, "import", false, "Store the given key in the cache, for launcher from --rgl if it's set")
+			addCacheFlag(flags, params)
+			addFormatFlag(flags, params)
+		},
+		validate: func(params *cliParams) error {
+			if params.keyHex != "" && params.keyFilePath != "" {
+				return ErrManyKeySources
+			}
 
-	if *outPath == "" {
-		fmt.Printf("You need to specify output path. Example:\n%s\n", helpCommand)
-		return nil
-	}
+			hasKey := params.keyHex != "" || params.keyFilePath != ""
 
-	outPathStat, err := os.Stat(*outPath)
-	if err == os.ErrNotExist {
-		err = os.MkdirAll(*outPath, 0755)
-		if err != nil {
-			fmt.Printf("Failed to create output path at: \"%s\"\n", *outPath)
-			fmt.Println("Try a different place or launch extractor with the administrative rights")
+			if params.importKey && !hasKey {
+				return ErrNoImportKey
+			}
+
+			if params.rglPath == "" && hasKey {
+				return nil
+			}
+
+			return validateLauncherPath(params)
+		},
+		run: showKeys,
+	},
+	{
+		name:        "discover",
+		usage:       "discover",
+		description: "Find RGL installations, natively on Windows or inside Wine and Proton prefixes elsewhere",
+		setup: func(flags *flag.FlagSet, params *cliParams) {
+			addFormatFlag(flags, params)
+		},
+		validate: func(params *cliParams) error {
 			return nil
+		},
+		run: discoverLaunchers,
+	},
+}
+
+func findCommand(name string) *cliCommand {
+	for _, command := range cliCommands {
+		if command.name == name {
+			return command
 		}
-	} else if err == nil && !outPathStat.IsDir() {
-		fmt.Printf("Invalid output path: \"%s\"\n", *outPath)
-		return nil
 	}
 
-	return &cliParams{
-		cmdType:    cmdType,
-		rglPath:    *rglPath,
-		outPath:    *outPath,
-		titlesPath: *titlesPath,
-	}
+	return nil
+}
+
+func addLauncherFlags(flags *flag.FlagSet, params *cliParams) {
+	flags.StringVar(&params.rglPath, "rgl", "", "Path to root folder of RGL installation, \"auto\" to search for it")
+	flags.StringVar(&params.rpfPath, "rpf", "", "Path to a single pack file, instead of RGL installation")
+	flags.StringVar(&params.keyHex, "key", "", "AES key as a hex string, instead of searching launcher.exe")
+	flags.StringVar(&params.keyFilePath, "key-file", "", "Path to a file with AES key, raw or as a hex string")
+	addCacheFlag(flags, params)
+	flags.StringVar(&params.ngKeysPath, "ngkeys", "", "Path to folder with GTA V NG key files (gtav_ng_key.dat, gtav_ng_decrypt_tables.dat)")
+}
+
+func addCacheFlag(flags *flag.FlagSet, params *cliParams) {
+	flags.StringVar(&params.cachePath, "cache", "", "Path to the key cache file, by default it's in the user cache folder")
+}
+
+func addFilterFlags(flags *flag.FlagSet, params *cliParams) {
+	flags.Var(&params.includes, "include", "Extract only entries matching a glob or \"re:\" regex pattern, can be repeated")
+	flags.Var(&params.excludes, "exclude", "Skip entries matching a glob or \"re:\" regex pattern, can be repeated")
+	flags.Var(&params.extensions, "ext", "Extract only entries with this extension, can be repeated")
+	flags.Int64Var(&params.minSize, "min-size", 0, "Extract only entries of at least this size in bytes")
+	flags.Int64Var(&params.maxSize, "max-size", 0, "Extract only entries of at most this size in bytes")
+}
+
+func addFormatFlag(flags *flag.FlagSet, params *cliParams) {
+	flags.StringVar(&params.format, "format", formatText, "Output format: text, json or ndjson")
 }
 
-func extractLauncher(params *cliParams) error {
-	rgl, err := LoadLauncher(params.rglPath)
+func addKeepGoingFlag(flags *flag.FlagSet, params *cliParams) {
+	flags.BoolVar(&params.keepGoing, "keep-going", false, "Don't stop on a failed item, report every failure at the end")
+}
 
+func validateDirectory(dirPath string) error {
+	pathStat, err := os.Stat(dirPath)
 	if err != nil {
 		return err
 	}
 
-	logFunc := func(log string) {
-		fmt.Println(log)
+	if !pathStat.IsDir() {
+		return ErrNotDirectory
+	}
+
+	return nil
+}
+
+// Packs come either from RGL installation or from a single file
+func validatePackSource(params *cliParams) error {
+	if params.keyHex != "" && params.keyFilePath != "" {
+		return ErrManyKeySources
+	}
+
+	if params.rglPath != "" && params.rpfPath != "" {
+		return ErrManyPackSources
+	}
+
+	if params.rpfPath == "" {
+		if params.rglPath == "" {
+			return ErrNoPackSource
+		}
+
+		return validateLauncherPath(params)
+	}
+
+	pathStat, err := os.Stat(params.rpfPath)
+	if err == nil && pathStat.IsDir() {
+		err = ErrIsDirectory
 	}
 
-	for _, packFile := range rgl.Files {
-		err = packFile.extractPackFile(params.outPath, logFunc)
+	if err != nil {
+		return fmt.Errorf("invalid pack file path \"%s\": %w", params.rpfPath, err)
+	}
+
+	return nil
+}
 
+func validateLauncherPath(params *cliParams) error {
+	if params.rglPath == "" {
+		return ErrNoLauncherPath
+	}
+
+	if params.rglPath == autoLauncherPath {
+		installPath, err := launcher.FindInstallation()
 		if err != nil {
 			return err
 		}
+
+		params.rglPath = installPath
+	}
+
+	if err := validateDirectory(params.rglPath); err != nil {
+		return fmt.Errorf("invalid launcher path \"%s\": %w", params.rglPath, err)
 	}
 
-	fmt.Printf("Done! Extracted into %s\n", params.outPath)
 	return nil
 }
 
-func decryptTitles(params *cliParams) error {
-	decryptFile := func(filePath string) error {
-		title, err := ReadTitleFromFile(filePath)
+// Output folder is created if it doesn't exist yet
+func validateOutDirectory(params *cliParams) error {
+	if params.outPath == "" {
+		return ErrNoOutPath
+	}
+
+	err := validateDirectory(params.outPath)
+	if os.IsNotExist(err) {
+		err = os.MkdirAll(params.outPath, 0755)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to create output path \"%s\": %w", params.outPath, err)
 		}
 
-		fileName := title.Name
-		if fileName == "" {
-			_, fileName = filepath.Split(filePath)
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid output path \"%s\": %w", params.outPath, err)
+	}
+
+	return nil
+}
+
+func buildFilter(params *cliParams) error {
+	if len(params.includes) == 0 && len(params.excludes) == 0 && len(params.extensions) == 0 &&
+		params.minSize <= 0 && params.maxSize <= 0 {
+		return nil
+	}
+
+	filter := &rpf.EntryFilter{
+		MinSize: params.minSize,
+		MaxSize: params.maxSize,
+	}
+
+	for _, pattern := range params.includes {
+		if err := filter.AddInclude(pattern); err != nil {
+			return fmt.Errorf("invalid include pattern \"%s\": %w", pattern, err)
 		}
+	}
 
-		outPath := filepath.Join(params.outPath, fileName+".rgl.json")
-		directory := filepath.Dir(outPath)
+	for _, pattern := range params.excludes {
+		if err := filter.AddExclude(pattern); err != nil {
+			return fmt.Errorf("invalid exclude pattern \"%s\": %w", pattern, err)
+		}
+	}
 
-		if _, err := os.Stat(directory); os.IsNotExist(err) {
-			err := os.MkdirAll(directory, 0755)
+	for _, extension := range params.extensions {
+		filter.AddExtension(extension)
+	}
 
-			if err != nil {
-				return err
-			}
+	params.filter = filter
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", appName)
+
+	for _, command := range cliCommands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", command.name, command.description)
+	}
+
+	fmt.Fprintf(os.Stderr, "\nRun \"%s help <command>\" for flags of a command. Example:\n", appName)
+	fmt.Fprintf(os.Stderr, "  %s extract --rgl \"C:\\Program Files\\Rockstar Games\\Launcher\" --out \"C:\\Launcher_rpf\"\n", appName)
+}
+
+func newCommandFlags(command *cliCommand, params *cliParams) *flag.FlagSet {
+	flags := flag.NewFlagSet(command.name, flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n\n%s\n\nFlags:\n", appName, command.usage, command.description)
+		flags.PrintDefaults()
+	}
+
+	command.setup(flags, params)
+	return flags
+}
+
+// Flags of the old single command interface, mapped onto subcommands
+func parseLegacyParams(args []string) (*cliCommand, *cliParams, error) {
+	params := &cliParams{}
+
+	flags := flag.NewFlagSet(appName, flag.ContinueOnError)
+	flags.Usage = printUsage
+
+	addLauncherFlags(flags, params)
+	addFilterFlags(flags, params)
+	addFormatFlag(flags, params)
+	addKeepGoingFlag(flags, params)
+	flags.StringVar(&params.outPath, "out", "", "Path to output folder for extraction")
+	flags.StringVar(&params.titlesPath, "titles", "", "Path to folder with title.rgl files to decrypt")
+	flags.StringVar(&params.entryPath, "entry", "", "Path of a single pack entry to extract, use --out - to write it to stdout")
+	flags.BoolVar(&params.recursive, "recursive", false, "Extract content of packs nested inside other packs")
+	flags.BoolVar(&params.listTree, "tree", false, "List content of packs as a tree instead of a table")
+	list := flags.Bool("list", false, "List content of packs instead of extracting it")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	name := "extract"
+	if params.titlesPath != "" {
+		name = "titles"
+	} else if *list {
+		name = "list"
+	} else if params.entryPath != "" {
+		name = "cat"
+	}
+
+	return findCommand(name), params, nil
+}
+
+// parseParams returns the command to run along with its validated params.
+// Command is nil if there is nothing to run, ErrBadArguments is returned
+// after usage has been printed
+func parseParams(args []string) (*cliCommand, *cliParams, error) {
+	if len(args) == 0 {
+		printUsage()
+		return nil, nil, ErrBadArguments
+	}
+
+	var command *cliCommand
+	var params *cliParams
+	var err error
+
+	switch name := args[0]; {
+	case strings.HasPrefix(name, "-"):
+		command, params, err = parseLegacyParams(args)
+		if err == flag.ErrHelp {
+			return nil, nil, nil
+		} else if err != nil {
+			// Flag package has already reported the error
+			return nil, nil, ErrBadArguments
+		}
+	case name == "help":
+		if len(args) < 2 {
+			printUsage()
+			return nil, nil, nil
 		}
 
-		file, err := os.OpenFile(outPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
-		if err != nil {
-			return err
+		command = findCommand(args[1])
+		if command == nil {
+			err = fmt.Errorf("%w: %s", ErrUnknownCommand, args[1])
+			break
 		}
 
-		defer file.Close()
+		newCommandFlags(command, &cliParams{}).Usage()
+		return nil, nil, nil
+	default:
+		command = findCommand(name)
+		if command == nil {
+			err = fmt.Errorf("%w: %s", ErrUnknownCommand, name)
+			break
+		}
 
-		content := title.decrypt()
-		if _, err = file.Write([]byte(content)); err != nil {
-			return err
+		params = &cliParams{}
+		err = newCommandFlags(command, params).Parse(args[1:])
+		if err == flag.ErrHelp {
+			return nil, nil, nil
+		} else if err != nil {
+			return nil, nil, ErrBadArguments
 		}
+	}
 
-		return nil
+	if err == nil {
+		params.output, err = newOutputWriter(params.format)
 	}
 
-	err := filepath.Walk(params.titlesPath, func(path string, info os.FileInfo, err error) error {
-		if err == nil && filepath.Ext(info.Name()) == ".rgl" {
-			decryptFile(path)
+	if err == nil {
+		err = command.validate(params)
+	}
 
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n\n", err)
+
+		if command != nil {
+			newCommandFlags(command, &cliParams{}).Usage()
+		} else {
+			printUsage()
 		}
-		return nil
-	})
 
-	if err != nil {
-		panic(err)
+		return nil, nil, ErrBadArguments
 	}
 
-	fmt.Printf("Done! Decrypted into %s\n", params.outPath)
-	return nil
+	keys.CachePath = params.cachePath
+	keys.OnCacheError = func(err error) {
+		fmt.Fprintf(os.Stderr, "Failed to save cache file: %s\n", err)
+	}
+
+	return command, params, nil
 }
@@ -0,0 +1,653 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Disquse/RGLExtractor/keys"
+	"github.com/Disquse/RGLExtractor/launcher"
+	"github.com/Disquse/RGLExtractor/rpf"
+	"github.com/Disquse/RGLExtractor/title"
+)
+
+func extractLauncher(params *cliParams) error {
+	rgl, err := openLauncher(params)
+
+	if err != nil {
+		return err
+	}
+
+	defer rgl.Close()
+
+	options := &rpf.ExtractOptions{
+		Recursive: params.recursive,
+		Filter:    params.filter,
+		KeepGoing: params.keepGoing,
+	}
+
+	partialErr := &partialError{}
+
+	for _, packName := range getOpenErrorNames(rgl) {
+		err := fmt.Errorf("failed to open \"%s\": %w", packName, rgl.OpenErrors[packName])
+
+		params.output.write(&outputRecord{
+			Record: recordEntry,
+			Pack:   packName,
+			Error:  getErrorString(err),
+		})
+
+		partialErr.add(err)
+	}
+
+	var progress *progressObserver
+	if params.progress {
+		progress = newProgressObserver(os.Stderr)
+
+		// Moves to the next line on errors too
+		defer progress.close()
+	}
+
+	for _, packName := range getPackNames(rgl) {
+		observers := observerList{}
+
+		if progress != nil {
+			observers = append(observers, progress)
+		} else if params.output.isText() {
+			observers = append(observers, &textObserver{writer: os.Stdout})
+		}
+
+		if !params.output.isText() {
+			observers = append(observers, &recordObserver{output: params.output, packName: packName})
+		}
+
+		options.Observer = observers
+
+		err = rgl.Files[packName].Extract(params.outPath, options)
+
+		if err != nil && !params.keepGoing {
+			return fmt.Errorf("failed to extract \"%s\": %w", packName, err)
+		}
+
+		if err != nil {
+			partialErr.add(err)
+		}
+	}
+
+	if progress != nil {
+		progress.finish()
+	}
+
+	if params.output.isText() {
+		fmt.Printf("Done! Extracted into %s\n", params.outPath)
+	}
+
+	return partialErr.getError()
+}
+
+func decryptTitles(params *cliParams) error {
+	// Found with the first title it works for, the rest usually use the
+	// same one. It's searched again for titles it doesn't decrypt
+	var titleKey *keys.TitleKey
+
+	decryptTitle := func(rglTitle *title.Title) (string, error) {
+		if titleKey != nil {
+			content, err := rglTitle.DecryptWithKey(titleKey.Key, titleKey.IV)
+			if err != title.ErrWrongKey {
+				return content, err
+			}
+		}
+
+		foundKey, err := getTitleKey(params, rglTitle)
+		if err != nil {
+			return "", err
+		}
+
+		titleKey = foundKey
+
+		return rglTitle.DecryptWithKey(titleKey.Key, titleKey.IV)
+	}
+
+	decryptFile := func(filePath string) (string, []byte, error) {
+		rglTitle, err := title.ReadFromFile(filePath)
+		if err != nil {
+			return "", nil, err
+		}
+
+		content, err := decryptTitle(rglTitle)
+		if err != nil {
+			return "", nil, err
+		}
+
+		fileName := rglTitle.Name
+		if fileName == "" {
+			_, fileName = filepath.Split(filePath)
+		}
+
+		outPath := filepath.Join(params.outPath, fileName+".rgl.json")
+		directory := filepath.Dir(outPath)
+
+		if _, err := os.Stat(directory); os.IsNotExist(err) {
+			err := os.MkdirAll(directory, 0755)
+
+			if err != nil {
+				return outPath, nil, err
+			}
+		}
+
+		file, err := os.OpenFile(outPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+		if err != nil {
+			return outPath, nil, err
+		}
+
+		defer file.Close()
+
+		if _, err = file.Write([]byte(content)); err != nil {
+			return outPath, nil, err
+		}
+
+		return outPath, []byte(content), nil
+	}
+
+	partialErr := &partialError{}
+
+	err := filepath.Walk(params.titlesPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if !params.keepGoing {
+				return err
+			}
+
+			partialErr.add(err)
+			return nil
+		}
+
+		if filepath.Ext(info.Name()) == ".rgl" {
+			startTime := time.Now()
+			outPath, content, err := decryptFile(path)
+
+			// Content type is only known for decrypted titles
+			contentType := ""
+			if err == nil {
+				contentType = rpf.DetectContentType(content)
+			}
+
+			params.output.write(&outputRecord{
+				Record:      recordTitle,
+				Path:        path,
+				Type:        "title",
+				ContentType: contentType,
+				Size:        int64(len(content)),
+				OnDiskSize:  info.Size(),
+				Output:      outPath,
+				DurationMs:  getDurationMs(time.Since(startTime)),
+				Error:       getErrorString(err),
+			})
+
+			if err != nil {
+				err = fmt.Errorf("failed to decrypt \"%s\": %w", path, err)
+
+				if !params.keepGoing {
+					return err
+				}
+
+				partialErr.add(err)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if params.output.isText() {
+		fmt.Printf("Done! Decrypted into %s\n", params.outPath)
+	}
+
+	return partialErr.getError()
+}
+
+func extractEntry(params *cliParams) error {
+	rgl, err := openLauncher(params)
+	if err != nil {
+		return err
+	}
+
+	defer rgl.Close()
+
+	for _, packName := range getPackNames(rgl) {
+		entryPath := trimPackName(params.entryPath, packName)
+
+		packFile, packEntry, err := rgl.Files[packName].FindNestedEntry(entryPath)
+		if err == rpf.ErrEntryNotFound {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if params.outPath == "-" {
+			return packFile.WriteEntry(packEntry, os.Stdout)
+		}
+
+		startTime := time.Now()
+		err = packFile.ExtractEntry(packEntry, params.outPath)
+
+		if !params.output.isText() {
+			info := packFile.GetEntryInfo(packEntry, entryPath)
+
+			params.output.write(&outputRecord{
+				Record:     recordEntry,
+				Pack:       packName,
+				Path:       params.entryPath,
+				Type:       info.Type,
+				Size:       info.Size,
+				OnDiskSize: info.OnDiskSize,
+				Output:     params.outPath,
+				DurationMs: getDurationMs(time.Since(startTime)),
+				Error:      getErrorString(err),
+			})
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if params.output.isText() {
+			fmt.Printf("Done! Extracted into %s\n", params.outPath)
+		}
+
+		return nil
+	}
+
+	return rpf.ErrEntryNotFound
+}
+
+// Entry paths may start with the pack name, like list and extract print them
+func trimPackName(entryPath string, packName string) string {
+	trimmed := strings.TrimLeft(strings.ReplaceAll(entryPath, "\\", "/"), "/")
+
+	if name, rest, found := strings.Cut(trimmed, "/"); found && strings.EqualFold(name, packName) {
+		return rest
+	}
+
+	return entryPath
+}
+
+func listLauncher(params *cliParams) error {
+	rgl, err := openLauncher(params)
+	if err != nil {
+		return err
+	}
+
+	defer rgl.Close()
+
+	for _, packName := range getPackNames(rgl) {
+		infos, err := rgl.Files[packName].ListEntries()
+		if err != nil {
+			return err
+		}
+
+		if !params.output.isText() {
+			writeEntryRecords(params.output, packName, infos)
+		} else if params.listTree {
+			printEntryTree(packName, infos)
+		} else {
+			printEntryTable(packName, infos)
+		}
+	}
+
+	return nil
+}
+
+func printEntryTable(packName string, infos []*rpf.EntryInfo) {
+	fmt.Printf("%s\n", packName)
+	fmt.Printf("%-9s %12s %12s %12s %-3s %s\n", "TYPE", "SIZE", "ON DISK", "OFFSET", "ENC", "PATH")
+
+	for _, info := range infos {
+		if info.Type == rpf.EntryTypeDirectory {
+			fmt.Printf("%-9s %12s %12s %12s %-3s %s/\n", info.Type, "-", "-", "-", "-", info.Path)
+			continue
+		}
+
+		fmt.Printf("%-9s %12d %12d %12s %-3s %s\n", info.Type, info.Size, info.OnDiskSize,
+			fmt.Sprintf("0x%X", info.Offset), formatEncrypted(info.Encrypted), info.Path)
+	}
+
+	fmt.Println()
+}
+
+func printEntryTree(packName string, infos []*rpf.EntryInfo) {
+	fmt.Printf("%s\n", packName)
+
+	for _, info := range infos {
+		indent := strings.Repeat("  ", strings.Count(info.Path, "/")+1)
+		name := path.Base(info.Path)
+
+		if info.Type == rpf.EntryTypeDirectory {
+			fmt.Printf("%s%s/\n", indent, name)
+			continue
+		}
+
+		fmt.Printf("%s%s (%s, size %d, on disk %d, offset 0x%X, encrypted %s)\n", indent, name,
+			info.Type, info.Size, info.OnDiskSize, info.Offset, formatEncrypted(info.Encrypted))
+	}
+
+	fmt.Println()
+}
+
+func writeEntryRecords(output *outputWriter, packName string, infos []*rpf.EntryInfo) {
+	for _, info := range infos {
+		output.write(&outputRecord{
+			Record:     recordEntry,
+			Pack:       packName,
+			Path:       info.Path,
+			Type:       info.Type,
+			Size:       info.Size,
+			OnDiskSize: info.OnDiskSize,
+			Offset:     info.Offset,
+			Encrypted:  info.Encrypted,
+		})
+	}
+}
+
+func formatEncrypted(encrypted bool) string {
+	if encrypted {
+		return "yes"
+	}
+
+	return "no"
+}
+
+func showInfo(params *cliParams) error {
+	rgl, err := openLauncher(params)
+	if err != nil {
+		return err
+	}
+
+	defer rgl.Close()
+
+	for _, packName := range getPackNames(rgl) {
+		packFile := rgl.Files[packName]
+		header := packFile.Header
+
+		if !params.output.isText() {
+			params.output.write(&packRecord{
+				Record:     recordPack,
+				Pack:       packName,
+				Path:       packFile.Path,
+				Size:       packFile.Size,
+				Version:    header.GetVersion(),
+				Entries:    header.EntryCount,
+				NameShift:  header.NameShift,
+				Encryption: header.GetEncryptionName(),
+			})
+
+			continue
+		}
+
+		fmt.Printf("%s\n", packName)
+		fmt.Printf("  Path:         %s\n", packFile.Path)
+		fmt.Printf("  Size:         %d\n", packFile.Size)
+		fmt.Printf("  Version:      RPF%d\n", header.GetVersion())
+		fmt.Printf("  Entries:      %d\n", header.EntryCount)
+		fmt.Printf("  Names length: %d\n", header.NamesLength)
+		fmt.Printf("  Name shift:   %d\n", header.NameShift)
+		fmt.Printf("  Encryption:   %s\n", header.GetEncryptionName())
+		fmt.Println()
+	}
+
+	return nil
+}
+
+func showKeys(params *cliParams) error {
+	key, err := getParamsKey(params)
+	if err != nil {
+		return err
+	}
+
+	var record *keys.CacheRecord
+
+	if key != nil {
+		record = &keys.CacheRecord{Key: key}
+
+		if params.rglPath != "" {
+			if record.Hash, err = keys.GetLauncherHash(params.rglPath); err != nil {
+				return err
+			}
+		}
+	} else if record, err = keys.LoadLauncherKey(params.rglPath); errors.Is(err, keys.ErrNoEncryptionKeys) {
+		record, err = launcher.RecoverLauncherKey(params.rglPath)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if params.importKey {
+		if err = keys.ImportKey(record.Key, record.Hash); err != nil {
+			return err
+		}
+	}
+
+	if params.exportPath != "" {
+		if err = keys.SaveKeyFile(params.exportPath, record.Key); err != nil {
+			return err
+		}
+	}
+
+	if !params.output.isText() {
+		params.output.write(newKeyRecord(params, record, key != nil))
+		return nil
+	}
+
+	fmt.Printf("Key:           %s\n", hex.EncodeToString(record.Key))
+
+	if record.Hash != nil {
+		fmt.Printf("Launcher hash: %s\n", hex.EncodeToString(record.Hash))
+	}
+
+	if key != nil {
+		fmt.Printf("Found at:      given explicitly\n")
+	} else if record.Recovered {
+		fmt.Printf("Found at:      %s, recovered by trying it on packs\n", record.Location)
+	} else if record.Location != nil {
+		fmt.Printf("Found at:      %s\n", record.Location)
+	} else {
+		fmt.Printf("Found at:      unknown, imported or from an old cache\n")
+	}
+
+	if record.Cached {
+		fmt.Printf("Cache:         %s\n", getCachePath(params))
+	}
+
+	if params.importKey {
+		fmt.Printf("Imported into %s\n", getCachePath(params))
+	}
+
+	if params.exportPath != "" {
+		fmt.Printf("Exported into %s\n", params.exportPath)
+	}
+
+	return nil
+}
+
+func newKeyRecord(params *cliParams, record *keys.CacheRecord, explicit bool) *keyRecord {
+	keyRecord := &keyRecord{
+		Record:   recordKey,
+		Key:      hex.EncodeToString(record.Key),
+		Hash:     hex.EncodeToString(record.Hash),
+		Source:   "launcher",
+		Cached:   record.Cached,
+		Imported: params.importKey,
+		Export:   params.exportPath,
+	}
+
+	if explicit {
+		keyRecord.Source = "explicit"
+	} else if record.Recovered {
+		keyRecord.Source = "recovered"
+	}
+
+	if record.Location != nil {
+		keyRecord.Location = record.Location.String()
+	}
+
+	if record.Cached || params.importKey {
+		keyRecord.Cache = getCachePath(params)
+	}
+
+	return keyRecord
+}
+
+func discoverLaunchers(params *cliParams) error {
+	installations := launcher.FindInstallations()
+	if len(installations) == 0 {
+		return launcher.ErrNoInstallation
+	}
+
+	for _, installation := range installations {
+		if !params.output.isText() {
+			params.output.write(&installRecord{
+				Record: recordInstall,
+				Path:   installation.Path,
+				Prefix: installation.Prefix,
+			})
+
+			continue
+		}
+
+		if installation.Prefix == "" {
+			fmt.Printf("%s\n", installation.Path)
+		} else {
+			fmt.Printf("%s (Wine prefix %s)\n", installation.Path, installation.Prefix)
+		}
+	}
+
+	return nil
+}
+
+// Returns a key that decrypts sample. With --rgl launcher.exe is searched,
+// otherwise the cached title key and the empty one are tried
+func getTitleKey(params *cliParams, sample *title.Title) (*keys.TitleKey, error) {
+	if params.rglPath != "" {
+		titleKey, err := keys.LoadTitleKey(params.rglPath, sample)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find title key in \"%s\": %w", params.rglPath, err)
+		}
+
+		return titleKey, nil
+	}
+
+	candidates := []*keys.TitleKey{keys.GetDefaultTitleKey()}
+
+	if cached, err := keys.LoadCachedTitleKey(); err == nil {
+		candidates = append([]*keys.TitleKey{cached}, candidates...)
+	}
+
+	for _, titleKey := range candidates {
+		if _, err := sample.DecryptWithKey(titleKey.Key, titleKey.IV); err == nil {
+			return titleKey, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w, pass --rgl to search launcher.exe for it", keys.ErrNoTitleKey)
+}
+
+// Returns the key given with --key or --key-file, nil if there is none
+func getParamsKey(params *cliParams) ([]byte, error) {
+	if params.keyHex != "" {
+		return keys.ParseKey(params.keyHex)
+	}
+
+	if params.keyFilePath != "" {
+		return keys.LoadKeyFile(params.keyFilePath)
+	}
+
+	return nil, nil
+}
+
+// Opens either RGL installation or a single pack. Key of a single pack is
+// taken from the cache if it's not given, it may also be not encrypted
+func openLauncher(params *cliParams) (*launcher.Launcher, error) {
+	key, err := getParamsKey(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil && params.rpfPath != "" {
+		return openPackWithCachedKeys(params)
+	}
+
+	if params.rpfPath != "" {
+		return launcher.OpenPack(params.rpfPath, key, params.ngKeysPath)
+	}
+
+	if params.keepGoing {
+		return launcher.LoadLauncherPartial(params.rglPath, key, params.ngKeysPath)
+	}
+
+	return launcher.LoadLauncherWithKey(params.rglPath, key, params.ngKeysPath)
+}
+
+// Cache may hold keys of many launcher versions, the pack tells which one
+// is right by failing with a wrong key. Unencrypted packs need none
+func openPackWithCachedKeys(params *cliParams) (*launcher.Launcher, error) {
+	cachedKeys, _ := keys.LoadCachedKeys()
+	if len(cachedKeys) == 0 {
+		return launcher.OpenPack(params.rpfPath, nil, params.ngKeysPath)
+	}
+
+	var err error
+
+	for _, key := range cachedKeys {
+		var rgl *launcher.Launcher
+
+		rgl, err = launcher.OpenPack(params.rpfPath, key, params.ngKeysPath)
+		if !errors.Is(err, rpf.ErrWrongKey) {
+			return rgl, err
+		}
+	}
+
+	return nil, err
+}
+
+func getCachePath(params *cliParams) string {
+	if params.cachePath != "" {
+		return params.cachePath
+	}
+
+	return keys.GetDefaultCachePath()
+}
+
+// Failed packs are reported in the same order every time
+func getOpenErrorNames(rgl *launcher.Launcher) []string {
+	packNames := make([]string, 0, len(rgl.OpenErrors))
+	for packName := range rgl.OpenErrors {
+		packNames = append(packNames, packName)
+	}
+
+	sort.Strings(packNames)
+
+	return packNames
+}
+
+// Packs are processed in the same order every time
+func getPackNames(rgl *launcher.Launcher) []string {
+	packNames := make([]string, 0, len(rgl.Files))
+	for packName := range rgl.Files {
+		packNames = append(packNames, packName)
+	}
+
+	sort.Strings(packNames)
+
+	return packNames
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Disquse/RGLExtractor/keys"
+	"github.com/Disquse/RGLExtractor/rpf"
+	"github.com/Disquse/RGLExtractor/title"
+)
+
+// Exit codes, stable for scripts
+const (
+	exitOK             = 0
+	exitFailure        = 1
+	exitBadArguments   = 2
+	exitMissingKey     = 3
+	exitCorruptArchive = 4
+	exitPartialFailure = 5
+	exitNotFound       = 6
+)
+
+// ErrBadArguments is returned by parseParams after it has printed usage
+var ErrBadArguments = errors.New("bad arguments")
+
+// Some items of a batch have failed with --keep-going
+type partialError struct {
+	failures []error
+}
+
+func (e *partialError) Error() string {
+	return fmt.Sprintf("%d items failed", len(e.failures))
+}
+
+// Collects failures of a batch, flattening ones reported by rpf
+func (e *partialError) add(err error) {
+	if extractErrors, ok := err.(rpf.ExtractErrors); ok {
+		e.failures = append(e.failures, extractErrors...)
+		return
+	}
+
+	e.failures = append(e.failures, err)
+}
+
+func (e *partialError) getError() error {
+	if len(e.failures) == 0 {
+		return nil
+	}
+
+	return e
+}
+
+var missingKeyErrors = []error{
+	keys.ErrNoExecutable,
+	keys.ErrNoEncryptionKeys,
+	keys.ErrNoTitleKey,
+	title.ErrWrongKey,
+	rpf.ErrNoCrypto,
+	rpf.ErrLegacyKey,
+	rpf.ErrNGKeys,
+	rpf.ErrNGTables,
+}
+
+var corruptArchiveErrors = []error{
+	rpf.ErrFileType,
+	rpf.ErrEncryption,
+	rpf.ErrLegacyTOC,
+	rpf.ErrNameOffset,
+	rpf.ErrNameTerminator,
+	rpf.ErrResourceSize,
+	rpf.ErrNestedCycle,
+	rpf.ErrNestedDepth,
+	title.ErrInvalidMagic,
+	title.ErrUnknownVersion,
+	title.ErrSizeMismatch,
+}
+
+func getExitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var partialErr *partialError
+	var packErr *rpf.PackError
+
+	if errors.Is(err, ErrBadArguments) || errors.Is(err, keys.ErrInvalidKey) {
+		return exitBadArguments
+	} else if errors.Is(err, rpf.ErrEntryNotFound) {
+		return exitNotFound
+	} else if errors.As(err, &partialErr) {
+		return exitPartialFailure
+	} else if errors.Is(err, rpf.ErrWrongKey) {
+		// Wraps the pack error that revealed the wrong key
+		return exitMissingKey
+	} else if errors.As(err, &packErr) {
+		return exitCorruptArchive
+	}
+
+	for _, target := range missingKeyErrors {
+		if errors.Is(err, target) {
+			return exitMissingKey
+		}
+	}
+
+	for _, target := range corruptArchiveErrors {
+		if errors.Is(err, target) {
+			return exitCorruptArchive
+		}
+	}
+
+	return exitFailure
+}
+
+// Prints every error of the chain on its own line, without repeating
+// messages of wrapped errors
+func printErrorChain(writer io.Writer, err error) {
+	if partialErr, ok := err.(*partialError); ok {
+		fmt.Fprintf(writer, "error: %s\n", partialErr)
+
+		for _, failure := range partialErr.failures {
+			fmt.Fprintf(writer, "  - %s\n", failure)
+		}
+
+		return
+	}
+
+	prefix := "error: "
+
+	for err != nil {
+		message := err.Error()
+		inner := errors.Unwrap(err)
+
+		if inner != nil && strings.HasSuffix(message, inner.Error()) {
+			message = strings.TrimSuffix(message, inner.Error())
+			message = strings.TrimRight(message, ": ")
+		} else if inner != nil && strings.Contains(message, inner.Error()) {
+			// Wrapped message is in the middle, like PackError does
+			inner = errors.Unwrap(inner)
+		}
+
+		if message != "" {
+			fmt.Fprintf(writer, "%s%s\n", prefix, message)
+			prefix = "  caused by: "
+		}
+
+		err = inner
+	}
+}
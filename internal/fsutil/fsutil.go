@@ -0,0 +1,48 @@
+// Package fsutil finds files of Windows programs on case-sensitive file
+// systems, where "launcher.exe" and "Launcher.exe" are different names
+package fsutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FindFile returns the path of name inside directory, ignoring case if
+// there is no exact match. The exact path is returned if nothing matches
+func FindFile(directory string, name string) string {
+	exactPath := filepath.Join(directory, name)
+
+	if _, err := os.Lstat(exactPath); err == nil {
+		return exactPath
+	}
+
+	files, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return exactPath
+	}
+
+	for _, file := range files {
+		if strings.EqualFold(file.Name(), name) {
+			return filepath.Join(directory, file.Name())
+		}
+	}
+
+	return exactPath
+}
+
+// ResolvePath is FindFile for every element of a path relative to root
+func ResolvePath(root string, elements ...string) string {
+	resolved := root
+
+	for _, element := range elements {
+		if element == "" || element == "." {
+			continue
+		}
+
+		resolved = FindFile(resolved, element)
+	}
+
+	return resolved
+}
@@ -3,7 +3,7 @@
 
 // Slightly edited, see original repo: https://github.com/kelindar/iostream
 
-package main
+package iostream
 
 import (
 	"bytes"
@@ -32,6 +32,58 @@ func newSource(r io.Reader) source {
 	return nil
 }
 
+type readerAtSource struct {
+	reader io.ReaderAt
+	offset int64
+}
+
+func newReaderAtSource(r io.ReaderAt) *readerAtSource {
+	return &readerAtSource{r, 0}
+}
+
+func (r *readerAtSource) GetOffset() int64 {
+	return r.offset
+}
+
+func (r *readerAtSource) SetOffset(offset int64) {
+	r.offset = offset
+}
+
+func (r *readerAtSource) Read(b []byte) (n int, err error) {
+	n, err = r.reader.ReadAt(b, r.offset)
+	r.offset += int64(n)
+
+	// ReaderAt may report EOF together with a full read
+	if n == len(b) && err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+func (r *readerAtSource) ReadByte() (byte, error) {
+	b, err := r.Slice(1)
+	if err != nil {
+		return 0, err
+	}
+
+	return b[0], nil
+}
+
+func (r *readerAtSource) Slice(n int) ([]byte, error) {
+	buffer := make([]byte, n)
+
+	read, err := r.reader.ReadAt(buffer, r.offset)
+	if read < n {
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+
+	r.offset += int64(n)
+	return buffer, nil
+}
+
 func newSliceSource(b []byte) *sliceSource {
 	return &sliceSource{b, 0}
 }
@@ -88,6 +140,12 @@ func NewReader(src io.Reader) *Reader {
 	}
 }
 
+func NewReaderAt(src io.ReaderAt) *Reader {
+	return &Reader{
+		src: newReaderAtSource(src),
+	}
+}
+
 func (r *Reader) GetOffset() int64 {
 	return r.src.GetOffset()
 }
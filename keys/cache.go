@@ -0,0 +1,475 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrCacheLocked is returned when another run holds the cache for too long
+var ErrCacheLocked = errors.New("keys: cache file is locked by another process")
+
+const (
+	cacheFileName    = "cache.bin"
+	cacheFileMagic   = "REcf"
+	cacheFileVersion = 3
+
+	// Single hash and key, kept for migration
+	cacheFileVersion1 = 1
+
+	// Many records without title keys, kept for migration
+	cacheFileVersion2 = 2
+
+	cacheDirectoryName = "RGLExtractor"
+	cacheLockSuffix    = ".lock"
+	cacheLockTimeout   = 10 * time.Second
+	cacheLockRetry     = 50 * time.Millisecond
+
+	// Lock files older than that are left by crashed runs
+	cacheLockStale = time.Minute
+)
+
+// Fields present in a record since version 3
+const (
+	cacheRecordKey      = 1 << 0
+	cacheRecordLocation = 1 << 1
+	cacheRecordTitleKey = 1 << 2
+)
+
+// CachePath is the path of the cache file, GetDefaultCachePath is used if
+// it's empty
+var CachePath string
+
+// OnCacheError is called when a found key can't be saved into the cache,
+// the key is still returned. Such errors are ignored if it's nil
+var OnCacheError func(err error)
+
+// CacheFile remembers keys found in every launcher.exe seen so far
+type CacheFile struct {
+	Version byte
+
+	// Records in order they were added, the latest is the last
+	Records []*CacheRecord
+}
+
+// CacheRecord is the key found in launcher.exe with a given hash
+type CacheRecord struct {
+	Hash []byte
+
+	// Pack key, nil if only the title key is known
+	Key []byte
+
+	// Where the key was found, nil for records migrated from version 1
+	Location *KeyLocation
+
+	// Key of title.rgl files, nil if it wasn't searched yet
+	TitleKey *TitleKey
+
+	// Set when the record was taken from the cache, not from launcher.exe
+	Cached bool
+
+	// Set when the key was found by trying it against a pack, not by its hash
+	Recovered bool
+}
+
+func reportCacheError(err error) {
+	if OnCacheError != nil {
+		OnCacheError(err)
+	}
+}
+
+// GetDefaultCachePath returns the cache file path in the user cache
+// directory, or in the working directory if there is none
+func GetDefaultCachePath() string {
+	directory, err := os.UserCacheDir()
+	if err != nil {
+		return cacheFileName
+	}
+
+	return filepath.Join(directory, cacheDirectoryName, cacheFileName)
+}
+
+func getCachePath() string {
+	if CachePath != "" {
+		return CachePath
+	}
+
+	return GetDefaultCachePath()
+}
+
+// LoadCache reads the cache file. Without a cache file at the default path
+// a version 1 file left in the working directory is migrated
+func LoadCache() (*CacheFile, error) {
+	cachePath := getCachePath()
+
+	content, err := ioutil.ReadFile(cachePath)
+	if os.IsNotExist(err) && CachePath == "" {
+		content, err = ioutil.ReadFile(cacheFileName)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return ReadCache(content)
+}
+
+// ReadCache parses content of a cache file of any known version
+func ReadCache(content []byte) (*CacheFile, error) {
+	if len(content) < 4+1 { // Magic, version
+		return nil, ErrClearCache
+	}
+
+	if string(content[:4]) != cacheFileMagic { // 'RGL Extractor cache file'
+		return nil, ErrClearCache
+	}
+
+	reader := bytes.NewReader(content[5:])
+
+	switch version := content[4]; version {
+	case cacheFileVersion1:
+		record, err := readCacheRecord(reader, version)
+		if err != nil {
+			return nil, ErrClearCache
+		}
+
+		return &CacheFile{Version: cacheFileVersion, Records: []*CacheRecord{record}}, nil
+	case cacheFileVersion2, cacheFileVersion:
+		var count uint32
+		if err := binary.Read(reader, binary.LittleEndian, &count); err != nil {
+			return nil, ErrClearCache
+		}
+
+		cache := &CacheFile{Version: cacheFileVersion}
+
+		for i := uint32(0); i < count; i++ {
+			record, err := readCacheRecord(reader, version)
+			if err != nil {
+				return nil, ErrClearCache
+			}
+
+			cache.Records = append(cache.Records, record)
+		}
+
+		return cache, nil
+	}
+
+	return nil, ErrClearCache
+}
+
+func readCacheRecord(reader io.Reader, version byte) (*CacheRecord, error) {
+	record := &CacheRecord{
+		Hash: make([]byte, 20),
+	}
+
+	if _, err := io.ReadFull(reader, record.Hash); err != nil {
+		return nil, err
+	}
+
+	// Older versions always have a key that goes first
+	if version == cacheFileVersion1 || version == cacheFileVersion2 {
+		return readOldCacheRecord(reader, version, record)
+	}
+
+	var flags byte
+	if err := binary.Read(reader, binary.LittleEndian, &flags); err != nil {
+		return nil, err
+	}
+
+	if flags&cacheRecordKey != 0 {
+		record.Key = make([]byte, keySize)
+
+		if _, err := io.ReadFull(reader, record.Key); err != nil {
+			return nil, err
+		}
+	}
+
+	if flags&cacheRecordLocation != 0 {
+		location, err := readKeyLocation(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		record.Location = location
+	}
+
+	if flags&cacheRecordTitleKey != 0 {
+		titleKey := &TitleKey{
+			Key: make([]byte, keySize),
+			IV:  make([]byte, titleIVSize),
+		}
+
+		if _, err := io.ReadFull(reader, titleKey.Key); err != nil {
+			return nil, err
+		}
+
+		if _, err := io.ReadFull(reader, titleKey.IV); err != nil {
+			return nil, err
+		}
+
+		record.TitleKey = titleKey
+	}
+
+	return record, nil
+}
+
+func readOldCacheRecord(reader io.Reader, version byte, record *CacheRecord) (*CacheRecord, error) {
+	record.Key = make([]byte, keySize)
+
+	if _, err := io.ReadFull(reader, record.Key); err != nil {
+		return nil, err
+	}
+
+	if version == cacheFileVersion1 {
+		return record, nil
+	}
+
+	var hasLocation byte
+	if err := binary.Read(reader, binary.LittleEndian, &hasLocation); err != nil {
+		return nil, err
+	}
+
+	if hasLocation != 0 {
+		location, err := readKeyLocation(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		record.Location = location
+	}
+
+	return record, nil
+}
+
+func readKeyLocation(reader io.Reader) (*KeyLocation, error) {
+	location := &KeyLocation{}
+
+	var nameLength byte
+	if err := binary.Read(reader, binary.LittleEndian, &nameLength); err != nil {
+		return nil, err
+	}
+
+	name := make([]byte, nameLength)
+	if _, err := io.ReadFull(reader, name); err != nil {
+		return nil, err
+	}
+
+	location.Section = string(name)
+
+	if err := binary.Read(reader, binary.LittleEndian, &location.Offset); err != nil {
+		return nil, err
+	}
+
+	if err := binary.Read(reader, binary.LittleEndian, &location.VirtualAddress); err != nil {
+		return nil, err
+	}
+
+	return location, nil
+}
+
+// FindRecord returns the record of launcher.exe with the given hash, or nil
+func (cf *CacheFile) FindRecord(hash []byte) *CacheRecord {
+	for _, record := range cf.Records {
+		if bytes.Equal(record.Hash, hash) {
+			return record
+		}
+	}
+
+	return nil
+}
+
+// AddRecord adds a record as the latest one, replacing one with the same hash
+func (cf *CacheFile) AddRecord(record *CacheRecord) {
+	records := cf.Records[:0]
+
+	for _, other := range cf.Records {
+		if !bytes.Equal(other.Hash, record.Hash) {
+			records = append(records, other)
+		}
+	}
+
+	cf.Records = append(records, record)
+}
+
+// Adds the pack key of a record, keeping the title key already known
+func (cf *CacheFile) setPackKey(record *CacheRecord) {
+	if existing := cf.FindRecord(record.Hash); existing != nil && record.TitleKey == nil {
+		record.TitleKey = existing.TitleKey
+	}
+
+	cf.AddRecord(record)
+}
+
+// Removes the pack key of a record, and the record if nothing else is left
+func (cf *CacheFile) removePackKey(hash []byte) {
+	records := cf.Records[:0]
+
+	for _, record := range cf.Records {
+		if bytes.Equal(record.Hash, hash) {
+			if record.TitleKey == nil {
+				continue
+			}
+
+			record.Key = nil
+			record.Location = nil
+		}
+
+		records = append(records, record)
+	}
+
+	cf.Records = records
+}
+
+// GetLatestRecord returns the record with a pack key added last, or nil
+func (cf *CacheFile) GetLatestRecord() *CacheRecord {
+	for i := len(cf.Records) - 1; i >= 0; i-- {
+		if cf.Records[i].Key != nil {
+			return cf.Records[i]
+		}
+	}
+
+	return nil
+}
+
+// GetLatestTitleRecord returns the record with a title key added last, or nil
+func (cf *CacheFile) GetLatestTitleRecord() *CacheRecord {
+	for i := len(cf.Records) - 1; i >= 0; i-- {
+		if cf.Records[i].TitleKey != nil {
+			return cf.Records[i]
+		}
+	}
+
+	return nil
+}
+
+// UpdateCache loads the cache, changes it with update and saves it back,
+// while holding a lock so parallel runs don't lose each other's records
+func UpdateCache(update func(cache *CacheFile)) error {
+	cachePath := getCachePath()
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+
+	unlock, err := lockCache(cachePath)
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	cache, err := LoadCache()
+	if err != nil {
+		cache = &CacheFile{Version: cacheFileVersion}
+	}
+
+	update(cache)
+
+	return cache.SaveCache()
+}
+
+// SaveCache writes the cache file in the current version. Content goes to
+// a temporary file first, so readers never see a partial one
+func (cf *CacheFile) SaveCache() error {
+	cachePath := getCachePath()
+	tempPath := cachePath + ".tmp"
+
+	var buffer bytes.Buffer
+
+	buffer.WriteString(cacheFileMagic)
+	buffer.WriteByte(cacheFileVersion)
+	binary.Write(&buffer, binary.LittleEndian, uint32(len(cf.Records)))
+
+	for _, record := range cf.Records {
+		var flags byte
+
+		if record.Key != nil {
+			flags |= cacheRecordKey
+		}
+
+		if record.Location != nil {
+			flags |= cacheRecordLocation
+		}
+
+		if record.TitleKey != nil {
+			flags |= cacheRecordTitleKey
+		}
+
+		buffer.Write(record.Hash)
+		buffer.WriteByte(flags)
+
+		if record.Key != nil {
+			buffer.Write(record.Key)
+		}
+
+		if record.Location != nil {
+			section := record.Location.Section
+			if len(section) > 0xFF {
+				section = section[:0xFF]
+			}
+
+			buffer.WriteByte(byte(len(section)))
+			buffer.WriteString(section)
+			binary.Write(&buffer, binary.LittleEndian, record.Location.Offset)
+			binary.Write(&buffer, binary.LittleEndian, record.Location.VirtualAddress)
+		}
+
+		if record.TitleKey != nil {
+			buffer.Write(record.TitleKey.Key)
+			buffer.Write(record.TitleKey.IV)
+		}
+	}
+
+	file, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(buffer.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, cachePath)
+}
+
+// Creates a lock file next to the cache, it works the same on every platform
+func lockCache(cachePath string) (func(), error) {
+	lockPath := cachePath + cacheLockSuffix
+	deadline := time.Now().Add(cacheLockTimeout)
+
+	for {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			file.Close()
+
+			return func() {
+				os.Remove(lockPath)
+			}, nil
+		}
+
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > cacheLockStale {
+			os.Remove(lockPath)
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return nil, ErrCacheLocked
+		}
+
+		time.Sleep(cacheLockRetry)
+	}
+}
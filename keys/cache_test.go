@@ -0,0 +1,267 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func makeTestBytes(seed byte, size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = seed + byte(i)
+	}
+
+	return data
+}
+
+func useTestCache(t *testing.T) {
+	t.Helper()
+
+	previous := CachePath
+	CachePath = filepath.Join(t.TempDir(), cacheFileName)
+
+	t.Cleanup(func() {
+		CachePath = previous
+	})
+}
+
+func writeTestLocation(buffer *bytes.Buffer, location *KeyLocation) {
+	buffer.WriteByte(byte(len(location.Section)))
+	buffer.WriteString(location.Section)
+	binary.Write(buffer, binary.LittleEndian, location.Offset)
+	binary.Write(buffer, binary.LittleEndian, location.VirtualAddress)
+}
+
+func TestReadCacheVersion1(t *testing.T) {
+	hash, key := makeTestBytes(1, 20), makeTestBytes(2, keySize)
+
+	var buffer bytes.Buffer
+	buffer.WriteString(cacheFileMagic)
+	buffer.WriteByte(cacheFileVersion1)
+	buffer.Write(hash)
+	buffer.Write(key)
+
+	cache, err := ReadCache(buffer.Bytes())
+	if err != nil {
+		t.Fatalf("ReadCache: %v", err)
+	}
+
+	want := &CacheFile{
+		Version: cacheFileVersion,
+		Records: []*CacheRecord{{Hash: hash, Key: key}},
+	}
+
+	if !reflect.DeepEqual(cache, want) {
+		t.Errorf("cache = %+v, want %+v", cache, want)
+	}
+}
+
+func TestReadCacheVersion2(t *testing.T) {
+	location := &KeyLocation{Section: ".rdata", Offset: 0x1234, VirtualAddress: 0x140005678}
+
+	records := []*CacheRecord{
+		{Hash: makeTestBytes(1, 20), Key: makeTestBytes(2, keySize), Location: location},
+		{Hash: makeTestBytes(3, 20), Key: makeTestBytes(4, keySize)},
+	}
+
+	var buffer bytes.Buffer
+	buffer.WriteString(cacheFileMagic)
+	buffer.WriteByte(cacheFileVersion2)
+	binary.Write(&buffer, binary.LittleEndian, uint32(len(records)))
+
+	for _, record := range records {
+		buffer.Write(record.Hash)
+		buffer.Write(record.Key)
+
+		if record.Location == nil {
+			buffer.WriteByte(0)
+			continue
+		}
+
+		buffer.WriteByte(1)
+		writeTestLocation(&buffer, record.Location)
+	}
+
+	cache, err := ReadCache(buffer.Bytes())
+	if err != nil {
+		t.Fatalf("ReadCache: %v", err)
+	}
+
+	want := &CacheFile{Version: cacheFileVersion, Records: records}
+
+	if !reflect.DeepEqual(cache, want) {
+		t.Errorf("cache = %+v, want %+v", cache, want)
+	}
+
+	// Migrated cache is saved in the current version
+	useTestCache(t)
+
+	if err := cache.SaveCache(); err != nil {
+		t.Fatalf("SaveCache: %v", err)
+	}
+
+	loaded, err := LoadCache()
+	if err != nil {
+		t.Fatalf("LoadCache: %v", err)
+	}
+
+	if !reflect.DeepEqual(loaded, want) {
+		t.Errorf("loaded = %+v, want %+v", loaded, want)
+	}
+}
+
+func TestReadCacheInvalid(t *testing.T) {
+	valid := append([]byte(cacheFileMagic), cacheFileVersion, 1, 0, 0, 0)
+
+	tests := [][]byte{
+		nil,
+		[]byte(cacheFileMagic),
+		append([]byte("XXXX"), valid[4:]...),
+		append([]byte(cacheFileMagic), 9, 0, 0, 0, 0),
+		valid, // Record is missing
+		append(valid, make([]byte, 20)...),
+	}
+
+	for _, content := range tests {
+		if _, err := ReadCache(content); err != ErrClearCache {
+			t.Errorf("ReadCache(%x) = %v, want %v", content, err, ErrClearCache)
+		}
+	}
+}
+
+func TestSaveCache(t *testing.T) {
+	useTestCache(t)
+
+	titleKey := &TitleKey{Key: makeTestBytes(5, keySize), IV: makeTestBytes(6, titleIVSize)}
+	location := &KeyLocation{Offset: 0x400}
+
+	cache := &CacheFile{
+		Version: cacheFileVersion,
+		Records: []*CacheRecord{
+			{Hash: makeTestBytes(1, 20), Key: makeTestBytes(2, keySize)},
+			{Hash: makeTestBytes(3, 20), Key: makeTestBytes(4, keySize), Location: location, TitleKey: titleKey},
+			{Hash: makeTestBytes(7, 20), TitleKey: titleKey},
+		},
+	}
+
+	if err := cache.SaveCache(); err != nil {
+		t.Fatalf("SaveCache: %v", err)
+	}
+
+	loaded, err := LoadCache()
+	if err != nil {
+		t.Fatalf("LoadCache: %v", err)
+	}
+
+	if !reflect.DeepEqual(loaded, cache) {
+		t.Errorf("loaded = %+v, want %+v", loaded, cache)
+	}
+
+	if record := loaded.GetLatestRecord(); record != loaded.Records[1] {
+		t.Errorf("GetLatestRecord = %+v, want the second record", record)
+	}
+
+	if record := loaded.GetLatestTitleRecord(); record != loaded.Records[2] {
+		t.Errorf("GetLatestTitleRecord = %+v, want the last record", record)
+	}
+}
+
+func TestUpdateCache(t *testing.T) {
+	useTestCache(t)
+
+	hash := makeTestBytes(1, 20)
+	titleKey := &TitleKey{Key: makeTestBytes(5, keySize), IV: makeTestBytes(6, titleIVSize)}
+
+	err := UpdateCache(func(cache *CacheFile) {
+		cache.AddRecord(&CacheRecord{Hash: hash, TitleKey: titleKey})
+	})
+
+	if err != nil {
+		t.Fatalf("UpdateCache: %v", err)
+	}
+
+	// Pack key is added to the record, title key stays
+	key := makeTestBytes(2, keySize)
+
+	err = UpdateCache(func(cache *CacheFile) {
+		cache.setPackKey(&CacheRecord{Hash: hash, Key: key})
+	})
+
+	if err != nil {
+		t.Fatalf("UpdateCache: %v", err)
+	}
+
+	cache, err := LoadCache()
+	if err != nil {
+		t.Fatalf("LoadCache: %v", err)
+	}
+
+	want := []*CacheRecord{{Hash: hash, Key: key, TitleKey: titleKey}}
+
+	if !reflect.DeepEqual(cache.Records, want) {
+		t.Errorf("records = %+v, want %+v", cache.Records, want)
+	}
+
+	cache.removePackKey(hash)
+
+	if record := cache.FindRecord(hash); record == nil || record.Key != nil || record.TitleKey == nil {
+		t.Errorf("record after removePackKey = %+v, want the title key only", record)
+	}
+
+	// Record without any key left is removed
+	cache.Records[0].TitleKey = nil
+	cache.removePackKey(hash)
+
+	if len(cache.Records) != 0 {
+		t.Errorf("records = %+v, want none", cache.Records)
+	}
+}
+
+// Accepts only the empty title key
+type emptyKeyChecker struct{}
+
+func (emptyKeyChecker) CheckKey(key []byte) bool {
+	return bytes.Equal(key, make([]byte, keySize))
+}
+
+func (emptyKeyChecker) DecryptWithKey(key []byte, iv []byte) (string, error) {
+	if !bytes.Equal(key, make([]byte, keySize)) {
+		return "", ErrNoTitleKey
+	}
+
+	return "{}", nil
+}
+
+func TestCacheErrorHook(t *testing.T) {
+	rootPath := t.TempDir()
+	if err := os.WriteFile(filepath.Join(rootPath, launcherFileName), []byte("MZ"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cache can't be created inside a file
+	previous := CachePath
+	CachePath = filepath.Join(rootPath, launcherFileName, cacheFileName)
+
+	var cacheErr error
+	OnCacheError = func(err error) {
+		cacheErr = err
+	}
+
+	t.Cleanup(func() {
+		CachePath = previous
+		OnCacheError = nil
+	})
+
+	titleKey, err := LoadTitleKey(rootPath, emptyKeyChecker{})
+	if err != nil || titleKey == nil {
+		t.Fatalf("LoadTitleKey = %v, %v, want the key without the cache", titleKey, err)
+	}
+
+	if cacheErr == nil {
+		t.Error("OnCacheError is not called")
+	}
+}
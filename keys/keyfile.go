@@ -0,0 +1,86 @@
+package keys
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	keySize = 32
+)
+
+// ErrInvalidKey is returned for a key of a wrong size or format
+var ErrInvalidKey = errors.New("keys: key must be 32 bytes or 64 hex characters")
+
+// ParseKey decodes a key from a hex string, spaces are ignored
+func ParseKey(text string) ([]byte, error) {
+	text = strings.Join(strings.Fields(text), "")
+	text = strings.TrimPrefix(strings.TrimPrefix(text, "0x"), "0X")
+
+	key, err := hex.DecodeString(text)
+	if err != nil || len(key) != keySize {
+		return nil, ErrInvalidKey
+	}
+
+	return key, nil
+}
+
+// LoadKeyFile reads a key file, either raw 32 bytes or a hex string
+func LoadKeyFile(filePath string) ([]byte, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(content) == keySize {
+		return content, nil
+	}
+
+	return ParseKey(string(bytes.TrimSpace(content)))
+}
+
+// SaveKeyFile writes a key file as a hex string, readable by LoadKeyFile
+func SaveKeyFile(filePath string, key []byte) error {
+	if len(key) != keySize {
+		return ErrInvalidKey
+	}
+
+	return ioutil.WriteFile(filePath, []byte(hex.EncodeToString(key)+"\n"), 0600)
+}
+
+// LoadCachedKey returns the key remembered by the latest run
+func LoadCachedKey() ([]byte, error) {
+	cache, err := LoadCache()
+	if err != nil {
+		return nil, err
+	}
+
+	record := cache.GetLatestRecord()
+	if record == nil {
+		return nil, ErrClearCache
+	}
+
+	return record.Key, nil
+}
+
+// LoadCachedKeys returns every cached key, the latest first, for packs
+// opened without a launcher to tell which one they need
+func LoadCachedKeys() ([][]byte, error) {
+	cache, err := LoadCache()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys [][]byte
+
+	for i := len(cache.Records) - 1; i >= 0; i-- {
+		if key := cache.Records[i].Key; key != nil {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
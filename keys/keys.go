@@ -0,0 +1,142 @@
+// Package keys finds the AES key of RGL packs in launcher.exe and caches it
+package keys
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"io"
+	"io/ioutil"
+
+	"github.com/Disquse/RGLExtractor/internal/fsutil"
+	"github.com/Disquse/RGLExtractor/internal/iostream"
+)
+
+// Named "Launcher.exe" by the installer, matched ignoring case
+const launcherFileName = "launcher.exe"
+
+var (
+	aesKeyHash = []byte{0x0E, 0x6B, 0x42, 0x74, 0x7E, 0xDF, 0x51, 0xDC, 0xE7, 0x8E, 0xD0, 0xA0, 0xA8, 0xFB, 0x22, 0xE9, 0x71, 0xC3, 0x16, 0x83}
+
+	ErrNoExecutable     = errors.New("keys: launcher.exe does not exist")
+	ErrNoEncryptionKeys = errors.New("keys: failed to find encryption keys")
+	ErrClearCache       = errors.New("keys: clear cache")
+)
+
+// FindLauncherKey returns the AES key for packs of RGL installed in rootPath.
+// The key is taken from the cache if launcher.exe didn't change since last time
+func FindLauncherKey(rootPath string) ([]byte, error) {
+	record, err := LoadLauncherKey(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return record.Key, nil
+}
+
+// LoadLauncherKey is FindLauncherKey that also returns the hash of
+// launcher.exe and location of the key
+func LoadLauncherKey(rootPath string) (*CacheRecord, error) {
+	executable, currentHash, err := readLauncher(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := LoadCache()
+	if err == nil {
+		if record := cache.FindRecord(currentHash); record != nil && record.Key != nil {
+			record.Cached = true
+			return record, nil
+		}
+	}
+
+	record, err := CreateRecord(executable, currentHash)
+	if err != nil {
+		return nil, ErrNoEncryptionKeys
+	}
+
+	err = UpdateCache(func(cache *CacheFile) {
+		cache.setPackKey(record)
+	})
+
+	if err != nil {
+		// We can just continue without saving...
+		reportCacheError(err)
+	}
+
+	return record, nil
+}
+
+// CreateRecord searches launcher.exe content for the key, hash is the
+// SHA-1 of the same content
+func CreateRecord(executable []byte, hash []byte) (*CacheRecord, error) {
+	key, location, err := FindKeyInExecutable(executable)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &CacheRecord{
+		Hash:     hash,
+		Key:      key,
+		Location: location,
+	}
+
+	return record, nil
+}
+
+// GetLauncherHash returns SHA-1 of launcher.exe, the key of cache records
+func GetLauncherHash(rootPath string) ([]byte, error) {
+	_, hash, err := readLauncher(rootPath)
+	return hash, err
+}
+
+// ImportKey stores a key obtained elsewhere in the cache, so it's used
+// without searching launcher.exe. Hash may be nil if the key is not tied
+// to a launcher version, it's still used for packs opened without one
+func ImportKey(key []byte, hash []byte) error {
+	if len(key) != keySize {
+		return ErrInvalidKey
+	}
+
+	if hash == nil {
+		hash = make([]byte, sha1.Size)
+	}
+
+	return UpdateCache(func(cache *CacheFile) {
+		cache.setPackKey(&CacheRecord{
+			Hash: hash,
+			Key:  key,
+		})
+	})
+}
+
+// InvalidateLauncherKey forgets the cached pack key of launcher.exe in
+// rootPath, after it turned out to be wrong. The next LoadLauncherKey
+// searches launcher.exe again, a cached title key is kept
+func InvalidateLauncherKey(rootPath string) error {
+	_, hash, err := readLauncher(rootPath)
+	if err != nil {
+		return err
+	}
+
+	return UpdateCache(func(cache *CacheFile) {
+		cache.removePackKey(hash)
+	})
+}
+
+func readLauncher(rootPath string) ([]byte, []byte, error) {
+	executable, err := ioutil.ReadFile(fsutil.FindFile(rootPath, launcherFileName))
+	if err != nil {
+		return nil, nil, ErrNoExecutable
+	}
+
+	reader := iostream.NewReader(bytes.NewBuffer(executable))
+
+	sha1 := sha1.New()
+	if _, err := io.Copy(sha1, reader); err != nil {
+		return nil, nil, err
+	}
+
+	// Get 20 bytes hash of sha1 sum
+	return executable, sha1.Sum(nil)[:20], nil
+}
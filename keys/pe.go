@@ -0,0 +1,244 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"debug/pe"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// Keys are stored aligned, so it's enough to check every 8th position
+	keyScanStep = 8
+
+	// Positions scanned by a worker at once
+	keyScanChunk = 64 * 1024
+
+	// Positions between checks for a match found by another worker
+	keyScanCheck = 1024
+)
+
+// KeyLocation tells where in launcher.exe the key was found
+type KeyLocation struct {
+	// Name of the PE section, empty if the key was found by the full scan
+	Section string
+
+	// Offset in launcher.exe
+	Offset int64
+
+	// Virtual address of the key in the loaded image, zero if unknown
+	VirtualAddress uint64
+}
+
+func (kl *KeyLocation) String() string {
+	if kl.Section == "" {
+		return fmt.Sprintf("offset 0x%X", kl.Offset)
+	}
+
+	return fmt.Sprintf("section %s, offset 0x%X, virtual address 0x%X", kl.Section, kl.Offset, kl.VirtualAddress)
+}
+
+// FindKeyInExecutable searches launcher.exe content for the key. Only
+// initialized data sections are scanned, the whole file is scanned if the
+// key isn't there or the file is not a valid PE
+func FindKeyInExecutable(executable []byte) ([]byte, *KeyLocation, error) {
+	key, location := findKeyInSections(executable)
+	if key != nil {
+		return key, location, nil
+	}
+
+	offset := scanForKey(executable)
+	if offset < 0 {
+		return nil, nil, ErrNoEncryptionKeys
+	}
+
+	key = make([]byte, keySize)
+	copy(key, executable[offset:])
+
+	return key, &KeyLocation{Offset: int64(offset)}, nil
+}
+
+func findKeyInSections(executable []byte) ([]byte, *KeyLocation) {
+	for _, section := range getDataSections(executable) {
+		offset := scanForKey(section.data)
+		if offset < 0 {
+			continue
+		}
+
+		key := make([]byte, keySize)
+		copy(key, section.data[offset:])
+
+		return key, section.getLocation(offset)
+	}
+
+	return nil, nil
+}
+
+// Initialized data section of launcher.exe
+type dataSection struct {
+	name           string
+	offset         int64
+	virtualAddress uint64
+	data           []byte
+}
+
+func (ds *dataSection) getLocation(offset int) *KeyLocation {
+	return &KeyLocation{
+		Section:        ds.name,
+		Offset:         ds.offset + int64(offset),
+		VirtualAddress: ds.virtualAddress + uint64(offset),
+	}
+}
+
+// Returns nothing if executable is not a valid PE
+func getDataSections(executable []byte) []*dataSection {
+	peFile, err := pe.NewFile(bytes.NewReader(executable))
+	if err != nil {
+		return nil
+	}
+
+	defer peFile.Close()
+
+	var imageBase uint64
+
+	switch header := peFile.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		imageBase = uint64(header.ImageBase)
+	case *pe.OptionalHeader64:
+		imageBase = header.ImageBase
+	}
+
+	var sections []*dataSection
+
+	for _, section := range peFile.Sections {
+		if !isDataSection(section) {
+			continue
+		}
+
+		start := uint64(section.Offset)
+		end := start + uint64(section.Size)
+
+		if end > uint64(len(executable)) {
+			end = uint64(len(executable))
+		}
+
+		if start >= end {
+			continue
+		}
+
+		sections = append(sections, &dataSection{
+			name:           section.Name,
+			offset:         int64(start),
+			virtualAddress: imageBase + uint64(section.VirtualAddress),
+			data:           executable[start:end],
+		})
+	}
+
+	return sections
+}
+
+// Initialized data that is not code, usually .rdata and .data
+func isDataSection(section *pe.Section) bool {
+	characteristics := section.Characteristics
+
+	return characteristics&pe.IMAGE_SCN_CNT_INITIALIZED_DATA != 0 &&
+		characteristics&pe.IMAGE_SCN_CNT_CODE == 0 &&
+		characteristics&pe.IMAGE_SCN_MEM_EXECUTE == 0
+}
+
+// Returns offset of the key in data, or -1. Big data is split into chunks
+// hashed in parallel, the lowest match wins just like with a sequential scan
+func scanForKey(data []byte) int {
+	positions := (len(data) - keySize + keyScanStep) / keyScanStep
+	if positions <= 0 {
+		return -1
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	chunkCount := (positions + keyScanChunk - 1) / keyScanChunk
+
+	if workers < 2 || chunkCount < 2 {
+		return scanChunkForKey(data, 0, positions, nil)
+	}
+
+	if workers > chunkCount {
+		workers = chunkCount
+	}
+
+	// Lowest offset found so far, chunks after it are not needed anymore
+	found := int64(math.MaxInt64)
+
+	chunks := make(chan int, chunkCount)
+	for chunk := 0; chunk < chunkCount; chunk++ {
+		chunks <- chunk
+	}
+
+	close(chunks)
+
+	var group sync.WaitGroup
+	group.Add(workers)
+
+	for worker := 0; worker < workers; worker++ {
+		go func() {
+			defer group.Done()
+
+			for chunk := range chunks {
+				start := chunk * keyScanChunk
+				end := start + keyScanChunk
+
+				if end > positions {
+					end = positions
+				}
+
+				offset := scanChunkForKey(data, start, end, &found)
+				if offset < 0 {
+					continue
+				}
+
+				// Keep the lowest offset
+				for {
+					current := atomic.LoadInt64(&found)
+					if int64(offset) >= current || atomic.CompareAndSwapInt64(&found, current, int64(offset)) {
+						break
+					}
+				}
+			}
+		}()
+	}
+
+	group.Wait()
+
+	if found == math.MaxInt64 {
+		return -1
+	}
+
+	return int(found)
+}
+
+// Scans positions [start, end) in steps of keyScanStep. Gives up as soon
+// as found points before the chunk, since a lower match already exists
+func scanChunkForKey(data []byte, start int, end int, found *int64) int {
+	sha1 := sha1.New()
+	sum := make([]byte, 0, sha1.Size())
+
+	for position := start; position < end; position++ {
+		offset := position * keyScanStep
+
+		if found != nil && position%keyScanCheck == 0 && atomic.LoadInt64(found) < int64(offset) {
+			return -1
+		}
+
+		sha1.Reset()
+		sha1.Write(data[offset : offset+keySize])
+
+		if bytes.Equal(aesKeyHash, sha1.Sum(sum)) {
+			return offset
+		}
+	}
+
+	return -1
+}
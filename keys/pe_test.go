@@ -0,0 +1,53 @@
+package keys
+
+import (
+	"crypto/sha1"
+	"runtime"
+	"testing"
+)
+
+func TestScanForKey(t *testing.T) {
+	key := makeTestBytes(0x40, keySize)
+	hash := sha1.Sum(key)
+
+	previousHash := aesKeyHash
+	aesKeyHash = hash[:]
+
+	// Chunks are only scanned in parallel with more than one worker
+	previousProcs := runtime.GOMAXPROCS(4)
+
+	t.Cleanup(func() {
+		aesKeyHash = previousHash
+		runtime.GOMAXPROCS(previousProcs)
+	})
+
+	chunkSize := keyScanChunk * keyScanStep
+	boundary := chunkSize - keySize/2
+
+	tests := []struct {
+		offsets []int
+		want    int
+	}{
+		{nil, -1},
+		{[]int{0}, 0},
+		{[]int{boundary}, boundary},
+		{[]int{2*chunkSize + 64}, 2*chunkSize + 64},
+		{[]int{3*chunkSize - keySize}, 3*chunkSize - keySize},
+		{[]int{2*chunkSize + 64, boundary}, boundary},
+		{[]int{chunkSize + 8, 2*chunkSize - keySize/2}, chunkSize + 8},
+	}
+
+	for _, test := range tests {
+		data := make([]byte, 3*chunkSize)
+		for _, offset := range test.offsets {
+			copy(data[offset:], key)
+		}
+
+		positions := (len(data) - keySize + keyScanStep) / keyScanStep
+		sequential := scanChunkForKey(data, 0, positions, nil)
+
+		if offset := scanForKey(data); offset != sequential || offset != test.want {
+			t.Errorf("key at %v: scanForKey = %d, sequential scan = %d, want %d", test.offsets, offset, sequential, test.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package keys
+
+// PackKeyChecker tells whether a key decrypts a pack, *rpf.KeyChecker is one
+type PackKeyChecker interface {
+	CheckKey(key []byte) bool
+}
+
+// RecoverLauncherKey is LoadLauncherKey for a launcher.exe with a key that
+// has no known hash. Every window of its data sections is tried against a
+// pack with checker, the key found is cached like a known one
+func RecoverLauncherKey(rootPath string, checker PackKeyChecker) (*CacheRecord, error) {
+	executable, currentHash, err := readLauncher(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	key, location, err := RecoverKeyInExecutable(executable, checker)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &CacheRecord{
+		Hash:      currentHash,
+		Key:       key,
+		Location:  location,
+		Recovered: true,
+	}
+
+	err = UpdateCache(func(cache *CacheFile) {
+		cache.setPackKey(record)
+	})
+
+	if err != nil {
+		// We can just continue without saving...
+		reportCacheError(err)
+	}
+
+	return record, nil
+}
+
+// RecoverKeyInExecutable searches launcher.exe content for any key that
+// checker accepts. Only data sections are tried, the whole file if it's
+// not a valid PE
+func RecoverKeyInExecutable(executable []byte, checker PackKeyChecker) ([]byte, *KeyLocation, error) {
+	sections := getDataSections(executable)
+	if sections == nil {
+		sections = []*dataSection{{data: executable}}
+	}
+
+	for _, section := range sections {
+		data := section.data
+
+		for offset := 0; offset+keySize <= len(data); offset += keyScanStep {
+			key := data[offset : offset+keySize]
+
+			if !hasKeyEntropy(key) || !checker.CheckKey(key) {
+				continue
+			}
+
+			return append([]byte(nil), key...), section.getLocation(offset), nil
+		}
+	}
+
+	return nil, nil, ErrNoEncryptionKeys
+}
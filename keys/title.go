@@ -0,0 +1,194 @@
+package keys
+
+import (
+	"errors"
+)
+
+// ErrNoTitleKey is returned when neither the default nor any key found in
+// launcher.exe decrypts titles
+var ErrNoTitleKey = errors.New("keys: no working title.rgl key found, titles may use a new key")
+
+const (
+	titleIVSize = 16
+
+	// Windows with fewer different bytes are tables or strings, not keys
+	keyMinDistinct = 12
+)
+
+// TitleKey decrypts title.rgl files
+type TitleKey struct {
+	Key []byte
+	IV  []byte
+}
+
+// TitleKeyChecker tells whether a key decrypts titles, *title.Title is one
+type TitleKeyChecker interface {
+	// Quick check of the key alone, false positives are allowed
+	CheckKey(key []byte) bool
+
+	// Complete check, error for a wrong key or IV
+	DecryptWithKey(key []byte, iv []byte) (string, error)
+}
+
+// GetDefaultTitleKey returns the empty key and IV titles used so far
+func GetDefaultTitleKey() *TitleKey {
+	return &TitleKey{
+		Key: make([]byte, keySize),
+		IV:  make([]byte, titleIVSize),
+	}
+}
+
+func (tk *TitleKey) check(checker TitleKeyChecker) bool {
+	_, err := checker.DecryptWithKey(tk.Key, tk.IV)
+	return err == nil
+}
+
+// Returns length of the decrypted JSON, or -1 if the key doesn't work
+func (tk *TitleKey) getContentLength(checker TitleKeyChecker) int {
+	content, err := checker.DecryptWithKey(tk.Key, tk.IV)
+	if err != nil {
+		return -1
+	}
+
+	return len(content)
+}
+
+// LoadTitleKey returns a key that decrypts titles checked by checker. The
+// key is taken from the cache if launcher.exe didn't change and it still
+// works, otherwise it's searched with FindTitleKey and cached
+func LoadTitleKey(rootPath string, checker TitleKeyChecker) (*TitleKey, error) {
+	executable, currentHash, err := readLauncher(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	cache, err := LoadCache()
+	if err == nil {
+		record := cache.FindRecord(currentHash)
+
+		if record != nil && record.TitleKey != nil && record.TitleKey.check(checker) {
+			return record.TitleKey, nil
+		}
+	}
+
+	titleKey, _, err := FindTitleKey(executable, checker)
+	if err != nil {
+		return nil, err
+	}
+
+	err = UpdateCache(func(cache *CacheFile) {
+		record := cache.FindRecord(currentHash)
+		if record == nil {
+			record = &CacheRecord{Hash: currentHash}
+		}
+
+		record.TitleKey = titleKey
+		cache.AddRecord(record)
+	})
+
+	if err != nil {
+		// We can just continue without saving...
+		reportCacheError(err)
+	}
+
+	return titleKey, nil
+}
+
+// LoadCachedTitleKey returns the title key remembered by the latest run
+// that searched for one
+func LoadCachedTitleKey() (*TitleKey, error) {
+	cache, err := LoadCache()
+	if err != nil {
+		return nil, err
+	}
+
+	record := cache.GetLatestTitleRecord()
+	if record == nil {
+		return nil, ErrClearCache
+	}
+
+	return record.TitleKey, nil
+}
+
+// FindTitleKey searches launcher.exe for a title key. The empty key goes
+// first, then every window of data sections as a key with a few IV
+// guesses. Location is nil for the empty key
+func FindTitleKey(executable []byte, checker TitleKeyChecker) (*TitleKey, *KeyLocation, error) {
+	if titleKey := GetDefaultTitleKey(); titleKey.check(checker) {
+		return titleKey, nil, nil
+	}
+
+	sections := getDataSections(executable)
+	if sections == nil {
+		sections = []*dataSection{{data: executable}}
+	}
+
+	for _, section := range sections {
+		offset, titleKey := scanForTitleKey(section.data, checker)
+		if titleKey != nil {
+			return titleKey, section.getLocation(offset), nil
+		}
+	}
+
+	return nil, nil, ErrNoTitleKey
+}
+
+// Tries every window as a key. IV is usually stored right next to the key,
+// so the neighbours are tried along with the empty one. A wrong IV still
+// decrypts everything except the first block, so the IV giving the most
+// content wins
+func scanForTitleKey(data []byte, checker TitleKeyChecker) (int, *TitleKey) {
+	emptyIV := make([]byte, titleIVSize)
+
+	for offset := 0; offset+keySize <= len(data); offset += keyScanStep {
+		key := data[offset : offset+keySize]
+
+		if !hasKeyEntropy(key) || !checker.CheckKey(key) {
+			continue
+		}
+
+		ivs := [][]byte{emptyIV}
+
+		if offset+keySize+titleIVSize <= len(data) {
+			ivs = append(ivs, data[offset+keySize:offset+keySize+titleIVSize])
+		}
+
+		if offset >= titleIVSize {
+			ivs = append(ivs, data[offset-titleIVSize:offset])
+		}
+
+		var bestKey *TitleKey
+		bestLength := -1
+
+		for _, iv := range ivs {
+			titleKey := &TitleKey{
+				Key: append([]byte(nil), key...),
+				IV:  append([]byte(nil), iv...),
+			}
+
+			if length := titleKey.getContentLength(checker); length > bestLength {
+				bestKey, bestLength = titleKey, length
+			}
+		}
+
+		if bestKey != nil {
+			return offset, bestKey
+		}
+	}
+
+	return -1, nil
+}
+
+func hasKeyEntropy(key []byte) bool {
+	var seen [256]bool
+	distinct := 0
+
+	for _, value := range key {
+		if !seen[value] {
+			seen[value] = true
+			distinct++
+		}
+	}
+
+	return distinct >= keyMinDistinct
+}
@@ -0,0 +1,290 @@
+package launcher
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/Disquse/RGLExtractor/internal/fsutil"
+)
+
+// ErrNoInstallation is returned when no RGL installation is found
+var ErrNoInstallation = errors.New("launcher: no RGL installation found")
+
+const (
+	registryFileName = "system.reg"
+
+	// Where the installer puts RGL unless told otherwise
+	defaultInstallPath = `C:\Program Files\Rockstar Games\Launcher`
+)
+
+// Registry keys with the install path, names are lowercase
+var installRegistryValues = []struct {
+	key   string
+	value string
+}{
+	{`software\wow6432node\rockstar games\launcher`, "installfolder"},
+	{`software\rockstar games\launcher`, "installfolder"},
+	{`software\wow6432node\microsoft\windows\currentversion\uninstall\rockstar games launcher`, "installlocation"},
+	{`software\microsoft\windows\currentversion\uninstall\rockstar games launcher`, "installlocation"},
+}
+
+// Wine prefixes made by Wine itself, Steam Proton, Lutris, Bottles and
+// Heroic, relative to the home directory
+var winePrefixPatterns = []string{
+	".wine",
+	".steam/steam/steamapps/compatdata/*/pfx",
+	".local/share/Steam/steamapps/compatdata/*/pfx",
+	".var/app/com.valvesoftware.Steam/.local/share/Steam/steamapps/compatdata/*/pfx",
+	".var/app/com.valvesoftware.Steam/data/Steam/steamapps/compatdata/*/pfx",
+	".local/share/bottles/bottles/*",
+	".var/app/com.usebottles.bottles/data/bottles/bottles/*",
+	"Games/*",
+	"Games/Heroic/Prefixes/*",
+	"Games/Heroic/Prefixes/default/*",
+}
+
+// Installation is an RGL installation found by FindInstallations
+type Installation struct {
+	// Path to root folder of RGL installation
+	Path string
+
+	// Wine prefix the installation is in, empty for a native one
+	Prefix string
+}
+
+// FindInstallation returns the path of the first RGL installation found by
+// FindInstallations
+func FindInstallation() (string, error) {
+	installations := FindInstallations()
+	if len(installations) == 0 {
+		return "", ErrNoInstallation
+	}
+
+	return installations[0].Path, nil
+}
+
+// FindInstallations searches the default install path on Windows, and Wine
+// prefixes elsewhere. The install path of a prefix is read from its
+// system.reg, the default one is tried if it's not there
+func FindInstallations() []*Installation {
+	var installations []*Installation
+
+	if runtime.GOOS == "windows" {
+		if isInstallation(defaultInstallPath) {
+			installations = append(installations, &Installation{Path: defaultInstallPath})
+		}
+
+		return installations
+	}
+
+	seen := map[string]bool{}
+
+	for _, prefix := range getWinePrefixes() {
+		installPath := findPrefixInstallation(prefix)
+		if installPath == "" || seen[installPath] {
+			continue
+		}
+
+		seen[installPath] = true
+		installations = append(installations, &Installation{Path: installPath, Prefix: prefix})
+	}
+
+	return installations
+}
+
+// Returns every existing prefix, $WINEPREFIX goes first
+func getWinePrefixes() []string {
+	var prefixes []string
+
+	if prefix := os.Getenv("WINEPREFIX"); prefix != "" {
+		prefixes = append(prefixes, prefix)
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return prefixes
+	}
+
+	for _, pattern := range winePrefixPatterns {
+		matches, err := filepath.Glob(filepath.Join(home, pattern))
+		if err != nil {
+			continue
+		}
+
+		prefixes = append(prefixes, matches...)
+	}
+
+	var existing []string
+
+	for _, prefix := range prefixes {
+		if _, err := os.Stat(filepath.Join(prefix, registryFileName)); err == nil {
+			existing = append(existing, prefix)
+		}
+	}
+
+	return existing
+}
+
+// Returns the RGL installation of a prefix, or an empty string
+func findPrefixInstallation(prefix string) string {
+	var windowsPaths []string
+
+	if installPath, err := readRegistryInstallPath(filepath.Join(prefix, registryFileName)); err == nil {
+		windowsPaths = append(windowsPaths, installPath)
+	}
+
+	windowsPaths = append(windowsPaths, defaultInstallPath)
+
+	for _, windowsPath := range windowsPaths {
+		installPath := getPrefixPath(prefix, windowsPath)
+
+		if installPath != "" && isInstallation(installPath) {
+			return installPath
+		}
+	}
+
+	return ""
+}
+
+// Maps a Windows path onto the prefix. Drives are symlinks in dosdevices,
+// drive_c is used if it's missing
+func getPrefixPath(prefix string, windowsPath string) string {
+	if len(windowsPath) < 2 || windowsPath[1] != ':' {
+		return ""
+	}
+
+	drive := strings.ToLower(windowsPath[:2])
+	drivePath := filepath.Join(prefix, "dosdevices", drive)
+
+	if _, err := os.Stat(drivePath); err != nil {
+		if drive != "c:" {
+			return ""
+		}
+
+		drivePath = filepath.Join(prefix, "drive_c")
+	} else if target, err := filepath.EvalSymlinks(drivePath); err == nil {
+		drivePath = target
+	}
+
+	elements := strings.FieldsFunc(windowsPath[2:], func(char rune) bool {
+		return char == '\\' || char == '/'
+	})
+
+	return fsutil.ResolvePath(drivePath, elements...)
+}
+
+func isInstallation(installPath string) bool {
+	info, err := os.Stat(fsutil.FindFile(installPath, "launcher.exe"))
+	return err == nil && !info.IsDir()
+}
+
+// Reads the install path from a registry file exported by Wine. Keys are
+// in brackets with doubled backslashes, values are "name"="data" lines
+func readRegistryInstallPath(registryPath string) (string, error) {
+	file, err := os.Open(registryPath)
+	if err != nil {
+		return "", err
+	}
+
+	defer file.Close()
+
+	// Found values by their order in installRegistryValues
+	found := make([]string, len(installRegistryValues))
+	section := ""
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(line, "[") {
+			end := strings.Index(line, "]")
+			if end < 0 {
+				continue
+			}
+
+			section = strings.ToLower(unescapeRegistryString(line[1:end]))
+			continue
+		}
+
+		if !strings.HasPrefix(line, "\"") {
+			continue
+		}
+
+		name, data, ok := parseRegistryValue(line)
+		if !ok {
+			continue
+		}
+
+		for i, value := range installRegistryValues {
+			if section == value.key && strings.ToLower(name) == value.value {
+				found[i] = data
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	for _, installPath := range found {
+		if installPath != "" {
+			return installPath, nil
+		}
+	}
+
+	return "", ErrNoInstallation
+}
+
+// Parses a "name"="data" line, other value types are ignored
+func parseRegistryValue(line string) (string, string, bool) {
+	name, rest, ok := readRegistryString(line)
+	if !ok || !strings.HasPrefix(rest, "=") {
+		return "", "", false
+	}
+
+	data, _, ok := readRegistryString(rest[1:])
+	if !ok {
+		return "", "", false
+	}
+
+	return name, data, true
+}
+
+// Reads a quoted string from the start of text, returns it unescaped and
+// the text after it
+func readRegistryString(text string) (string, string, bool) {
+	if !strings.HasPrefix(text, "\"") {
+		return "", "", false
+	}
+
+	for i := 1; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case '"':
+			return unescapeRegistryString(text[1:i]), text[i+1:], true
+		}
+	}
+
+	return "", "", false
+}
+
+func unescapeRegistryString(text string) string {
+	var builder strings.Builder
+
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			i++
+		}
+
+		builder.WriteByte(text[i])
+	}
+
+	return builder.String()
+}
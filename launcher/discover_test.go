@@ -0,0 +1,122 @@
+package launcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testRegistry = `WINE REGISTRY Version 2
+;; All keys relative to \\Machine
+
+#arch=win64
+
+[Software\\Rockstar Games\\Launcher] 1700000000
+#time=1da0000000000000
+"InstallFolder"="D:\\Games\\Rockstar Games\\Launcher"
+"Language"="en-US"
+
+[Software\\Wow6432Node\\Rockstar Games\\Launcher] 1700000000
+"Version"=dword:00000001
+"InstallFolder"="C:\\Program Files\\Rockstar \"Games\"\\Launcher"
+`
+
+func writeTestFile(t *testing.T, filePath string, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseRegistryValue(t *testing.T) {
+	tests := []struct {
+		line string
+		name string
+		data string
+		ok   bool
+	}{
+		{`"InstallFolder"="C:\\Games"`, "InstallFolder", `C:\Games`, true},
+		{`"Name"="say \"hi\""`, "Name", `say "hi"`, true},
+		{`"Version"=dword:00000001`, "", "", false},
+		{`"Broken"="no end`, "", "", false},
+		{`@="default"`, "", "", false},
+	}
+
+	for _, test := range tests {
+		name, data, ok := parseRegistryValue(test.line)
+		if name != test.name || data != test.data || ok != test.ok {
+			t.Errorf("parseRegistryValue(%q) = %q, %q, %v, want %q, %q, %v",
+				test.line, name, data, ok, test.name, test.data, test.ok)
+		}
+	}
+}
+
+func TestReadRegistryInstallPath(t *testing.T) {
+	registryPath := filepath.Join(t.TempDir(), registryFileName)
+	writeTestFile(t, registryPath, testRegistry)
+
+	installPath, err := readRegistryInstallPath(registryPath)
+	if err != nil {
+		t.Fatalf("readRegistryInstallPath: %v", err)
+	}
+
+	// Wow6432Node key goes first, whatever the order in the file
+	if want := `C:\Program Files\Rockstar "Games"\Launcher`; installPath != want {
+		t.Errorf("install path = %q, want %q", installPath, want)
+	}
+
+	writeTestFile(t, registryPath, "WINE REGISTRY Version 2\n[Software\\\\Other] 1\n\"InstallFolder\"=\"C:\\\\Other\"\n")
+
+	if _, err := readRegistryInstallPath(registryPath); err != ErrNoInstallation {
+		t.Errorf("readRegistryInstallPath without the key = %v, want %v", err, ErrNoInstallation)
+	}
+}
+
+func TestFindPrefixInstallation(t *testing.T) {
+	prefix := t.TempDir()
+
+	// Names differ in case from the registry, like they often do in prefixes
+	installPath := filepath.Join(prefix, "drive_c", "games", "rockstar games", "launcher")
+	writeTestFile(t, filepath.Join(installPath, "Launcher.exe"), "")
+
+	writeTestFile(t, filepath.Join(prefix, registryFileName),
+		"[Software\\\\Rockstar Games\\\\Launcher] 1\n\"InstallFolder\"=\"C:\\\\Games\\\\Rockstar Games\\\\Launcher\"\n")
+
+	if found := findPrefixInstallation(prefix); found != installPath {
+		t.Errorf("findPrefixInstallation = %q, want %q", found, installPath)
+	}
+}
+
+func TestGetPrefixPath(t *testing.T) {
+	prefix := t.TempDir()
+	drivePath := t.TempDir()
+
+	if err := os.MkdirAll(filepath.Join(prefix, "dosdevices"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(drivePath, filepath.Join(prefix, "dosdevices", "d:")); err != nil {
+		t.Skipf("symlinks are not supported: %v", err)
+	}
+
+	tests := []struct {
+		windowsPath string
+		want        string
+	}{
+		{`D:\Games\Launcher`, filepath.Join(drivePath, "Games", "Launcher")},
+		{`C:\Launcher`, filepath.Join(prefix, "drive_c", "Launcher")},
+		{`E:\Launcher`, ""},
+		{`Launcher`, ""},
+	}
+
+	for _, test := range tests {
+		if got := getPrefixPath(prefix, test.windowsPath); got != test.want {
+			t.Errorf("getPrefixPath(%q) = %q, want %q", test.windowsPath, got, test.want)
+		}
+	}
+}
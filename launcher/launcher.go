@@ -0,0 +1,217 @@
+// Package launcher opens packs of a Rockstar Games Launcher installation
+package launcher
+
+import (
+	"errors"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Disquse/RGLExtractor/keys"
+	"github.com/Disquse/RGLExtractor/rpf"
+)
+
+// Launcher is an opened RGL installation
+type Launcher struct {
+	// Path to RGL installation
+	Path string
+
+	// Pack files, usually just "Launcher.rpf"
+	Files map[string]*rpf.PackFile
+
+	// AES crypto instance
+	Crypto *rpf.AESCrypto
+
+	// GTA V NG crypto instance, optional
+	NGCrypto *rpf.NGCrypto
+
+	// Packs that failed to open by their names, only filled by
+	// LoadLauncherPartial
+	OpenErrors map[string]error
+}
+
+// LoadLauncher finds the key in launcher.exe and opens every pack in the
+// root of the installation. NG keys are loaded only if ngKeysPath is set
+func LoadLauncher(rootPath string, ngKeysPath string) (*Launcher, error) {
+	return LoadLauncherWithKey(rootPath, nil, ngKeysPath)
+}
+
+// LoadLauncherWithKey is LoadLauncher with a known key, launcher.exe is
+// searched only if key is nil. A cached key that turns out to be wrong is
+// removed from the cache and searched again. If the key with the known hash
+// is wrong too, it's recovered with RecoverLauncherKey
+func LoadLauncherWithKey(rootPath string, key []byte, ngKeysPath string) (*Launcher, error) {
+	return loadLauncherWithKey(rootPath, key, ngKeysPath, false)
+}
+
+// LoadLauncherPartial is LoadLauncherWithKey that keeps going when a pack
+// fails to open, its error is put into OpenErrors. A wrong key still fails
+// the whole installation, since it's the same for every pack
+func LoadLauncherPartial(rootPath string, key []byte, ngKeysPath string) (*Launcher, error) {
+	return loadLauncherWithKey(rootPath, key, ngKeysPath, true)
+}
+
+func loadLauncherWithKey(rootPath string, key []byte, ngKeysPath string, keepGoing bool) (*Launcher, error) {
+	rgl, cached, err := loadLauncher(rootPath, key, false, ngKeysPath, keepGoing)
+
+	if err != nil && cached && errors.Is(err, rpf.ErrWrongKey) {
+		if err := keys.InvalidateLauncherKey(rootPath); err != nil {
+			return nil, err
+		}
+
+		rgl, _, err = loadLauncher(rootPath, nil, false, ngKeysPath, keepGoing)
+	}
+
+	if err != nil && key == nil && errors.Is(err, rpf.ErrWrongKey) {
+		record, recoverErr := RecoverLauncherKey(rootPath)
+		if recoverErr != nil {
+			return nil, err
+		}
+
+		rgl, _, err = loadLauncher(rootPath, record.Key, true, ngKeysPath, keepGoing)
+	}
+
+	return rgl, err
+}
+
+// Also tells whether the key was taken from the cache. Key may come from
+// launcher.exe even if it's set, when it was recovered
+func loadLauncher(rootPath string, key []byte, launcherKey bool, ngKeysPath string, keepGoing bool) (*Launcher, bool, error) {
+	rgl := Launcher{
+		Path:       rootPath,
+		Files:      map[string]*rpf.PackFile{},
+		OpenErrors: map[string]error{},
+	}
+
+	cached, err := rgl.initCrypto(key, launcherKey, ngKeysPath)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = rgl.loadPackFiles(keepGoing)
+	if err != nil {
+		rgl.Close()
+		return nil, cached, err
+	}
+
+	return &rgl, cached, nil
+}
+
+// OpenPack opens a single pack outside of an RGL installation. Key may be
+// nil for packs that aren't encrypted with AES
+func OpenPack(filePath string, key []byte, ngKeysPath string) (*Launcher, error) {
+	rgl := Launcher{
+		Path:  filepath.Dir(filePath),
+		Files: map[string]*rpf.PackFile{},
+	}
+
+	var err error
+
+	if key != nil {
+		_, err = rgl.initCrypto(key, false, ngKeysPath)
+	} else {
+		err = rgl.initNGCrypto(ngKeysPath)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	packFile, err := rpf.OpenPackFile(filePath, rgl.Crypto, rgl.NGCrypto)
+	if err != nil {
+		return nil, err
+	}
+
+	rgl.Files[filepath.Base(filePath)] = packFile
+
+	return &rgl, nil
+}
+
+// Close closes every pack file of the installation
+func (rgl *Launcher) Close() error {
+	var firstErr error
+
+	for _, packFile := range rgl.Files {
+		if err := packFile.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// Returns true if the key was taken from the cache. A key searched in
+// launcher.exe is marked as such, legacy packs need a different one
+func (rgl *Launcher) initCrypto(key []byte, launcherKey bool, ngKeysPath string) (bool, error) {
+	cached := false
+
+	if key == nil {
+		launcherKey = true
+
+		record, err := keys.LoadLauncherKey(rgl.Path)
+		if errors.Is(err, keys.ErrNoEncryptionKeys) {
+			// The key was changed, so its hash is not known yet
+			record, err = RecoverLauncherKey(rgl.Path)
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		key, cached = record.Key, record.Cached
+	}
+
+	var err error
+
+	rgl.Crypto, err = rpf.NewAESCrypto(key)
+	if err != nil {
+		return cached, err
+	}
+
+	rgl.Crypto.LauncherKey = launcherKey
+
+	return cached, rgl.initNGCrypto(ngKeysPath)
+}
+
+func (rgl *Launcher) initNGCrypto(ngKeysPath string) error {
+	if ngKeysPath == "" {
+		return nil
+	}
+
+	var err error
+
+	rgl.NGCrypto, err = rpf.LoadNGCrypto(ngKeysPath)
+	return err
+}
+
+// Failures are collected into OpenErrors with keepGoing, except a wrong key
+func (rgl *Launcher) loadPackFiles(keepGoing bool) error {
+	// Assume RPF files are only in root directory
+	files, err := ioutil.ReadDir(rgl.Path)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		packName := file.Name()
+
+		if !strings.HasSuffix(strings.ToLower(packName), ".rpf") {
+			continue
+		}
+
+		packFile, err := rpf.OpenPackFile(path.Join(rgl.Path, packName), rgl.Crypto, rgl.NGCrypto)
+		if err != nil && keepGoing && !errors.Is(err, rpf.ErrWrongKey) {
+			rgl.OpenErrors[packName] = err
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		rgl.Files[packName] = packFile
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package launcher
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"testing"
+)
+
+// Plain RPF7 pack with an empty root directory
+func makeEmptyPack() string {
+	pack := make([]byte, 48)
+
+	copy(pack, "7FPR")
+	binary.LittleEndian.PutUint32(pack[4:], 1)
+	binary.LittleEndian.PutUint32(pack[8:], 16)
+	binary.LittleEndian.PutUint64(pack[16:], 0x7FFFFF<<40)
+
+	return string(pack)
+}
+
+func TestLoadLauncherPartial(t *testing.T) {
+	rootPath := t.TempDir()
+	key := make([]byte, 32)
+
+	writeTestFile(t, filepath.Join(rootPath, "good.rpf"), makeEmptyPack())
+	writeTestFile(t, filepath.Join(rootPath, "broken.rpf"), "not a pack")
+
+	if _, err := LoadLauncherWithKey(rootPath, key, ""); err == nil {
+		t.Error("LoadLauncherWithKey opens an installation with a broken pack")
+	}
+
+	rgl, err := LoadLauncherPartial(rootPath, key, "")
+	if err != nil {
+		t.Fatalf("LoadLauncherPartial: %v", err)
+	}
+
+	defer rgl.Close()
+
+	if len(rgl.Files) != 1 || rgl.Files["good.rpf"] == nil {
+		t.Errorf("files = %v, want good.rpf", rgl.Files)
+	}
+
+	if len(rgl.OpenErrors) != 1 || rgl.OpenErrors["broken.rpf"] == nil {
+		t.Errorf("open errors = %v, want broken.rpf", rgl.OpenErrors)
+	}
+}
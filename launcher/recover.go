@@ -0,0 +1,47 @@
+package launcher
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Disquse/RGLExtractor/keys"
+	"github.com/Disquse/RGLExtractor/rpf"
+)
+
+// RecoverLauncherKey finds a key of launcher.exe that has no known hash, by
+// trying it against the TOC of AES encrypted packs of the installation
+func RecoverLauncherKey(rootPath string) (*keys.CacheRecord, error) {
+	files, err := ioutil.ReadDir(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var packNames []string
+
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(strings.ToLower(file.Name()), ".rpf") {
+			packNames = append(packNames, file.Name())
+		}
+	}
+
+	sort.Strings(packNames)
+
+	for _, packName := range packNames {
+		checker, err := rpf.NewKeyChecker(filepath.Join(rootPath, packName))
+		if err != nil {
+			// Not encrypted with AES or not a pack at all, try the next one
+			continue
+		}
+
+		record, err := keys.RecoverLauncherKey(rootPath, checker)
+		checker.Close()
+
+		if err == nil {
+			return record, nil
+		}
+	}
+
+	return nil, keys.ErrNoEncryptionKeys
+}
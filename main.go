@@ -1,21 +1,24 @@
 package main
 
+import (
+	"os"
+)
+
 func main() {
-	params := parseParams()
-	if params == nil {
-		return
+	command, params, err := parseParams(os.Args[1:])
+	if err != nil {
+		os.Exit(getExitCode(err))
 	}
 
-	var err error
-
-	switch params.cmdType {
-	case cmdDecryptTitles:
-		err = decryptTitles(params)
-	case cmdExtractLauncher:
-		err = extractLauncher(params)
+	if command == nil {
+		return
 	}
 
+	err = command.run(params)
+	params.output.finish(command.name, err)
+
 	if err != nil {
-		panic(err)
+		printErrorChain(os.Stderr, err)
+		os.Exit(getExitCode(err))
 	}
 }
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/Disquse/RGLExtractor/rpf"
+)
+
+const (
+	progressBarWidth    = 30
+	progressRedrawDelay = 100 * time.Millisecond
+)
+
+// Sends every event to each of the observers
+type observerList []rpf.Observer
+
+func (ol observerList) PackOpened(event *rpf.PackOpenedEvent) {
+	for _, observer := range ol {
+		observer.PackOpened(event)
+	}
+}
+
+func (ol observerList) EntryStarted(event *rpf.EntryStartedEvent) {
+	for _, observer := range ol {
+		observer.EntryStarted(event)
+	}
+}
+
+func (ol observerList) EntryDone(event *rpf.EntryDoneEvent) {
+	for _, observer := range ol {
+		observer.EntryDone(event)
+	}
+}
+
+func (ol observerList) EntrySkipped(event *rpf.EntrySkippedEvent) {
+	for _, observer := range ol {
+		observer.EntrySkipped(event)
+	}
+}
+
+func (ol observerList) Error(event *rpf.ErrorEvent) {
+	for _, observer := range ol {
+		observer.Error(event)
+	}
+}
+
+// Prints a line per pack and entry, like the tool always did
+type textObserver struct {
+	rpf.BaseObserver
+	writer io.Writer
+}
+
+func (to *textObserver) PackOpened(event *rpf.PackOpenedEvent) {
+	fmt.Fprintf(to.writer, "Extracting pack file \"%s\"\n", path.Base(event.Pack.Path))
+}
+
+func (to *textObserver) EntryStarted(event *rpf.EntryStartedEvent) {
+	fmt.Fprintf(to.writer, "Extracting pack entry \"%s\"\n", event.Path)
+}
+
+// Turns extracted entries into output records
+type recordObserver struct {
+	rpf.BaseObserver
+	output   *outputWriter
+	packName string
+
+	// Failed entries already written by EntryDone
+	failedPaths map[string]bool
+}
+
+func (ro *recordObserver) EntryDone(event *rpf.EntryDoneEvent) {
+	if event.Err != nil {
+		if ro.failedPaths == nil {
+			ro.failedPaths = map[string]bool{}
+		}
+
+		ro.failedPaths[event.Path] = true
+	}
+
+	ro.output.write(&outputRecord{
+		Record:      recordEntry,
+		Pack:        ro.packName,
+		Path:        event.Path,
+		Type:        event.Type,
+		ContentType: event.ContentType,
+		Size:        event.Size,
+		OnDiskSize:  event.OnDiskSize,
+		Output:      event.OutPath,
+		DurationMs:  getDurationMs(event.Duration),
+		Error:       getErrorString(event.Err),
+	})
+}
+
+// Failures of nested packs come without EntryDone, so they get a record here
+func (ro *recordObserver) Error(event *rpf.ErrorEvent) {
+	if ro.failedPaths[event.Path] {
+		return
+	}
+
+	ro.output.write(&outputRecord{
+		Record: recordEntry,
+		Pack:   ro.packName,
+		Path:   event.Path,
+		Error:  getErrorString(event.Err),
+	})
+}
+
+// Draws a single line progress bar. Totals grow as nested packs are opened
+type progressObserver struct {
+	rpf.BaseObserver
+	writer io.Writer
+
+	startTime  time.Time
+	drawTime   time.Time
+	totalCount int
+	totalSize  int64
+	doneCount  int
+	doneSize   int64
+	failed     int
+	finished   bool
+	closed     bool
+}
+
+func newProgressObserver(writer io.Writer) *progressObserver {
+	return &progressObserver{
+		writer:    writer,
+		startTime: time.Now(),
+	}
+}
+
+func (po *progressObserver) PackOpened(event *rpf.PackOpenedEvent) {
+	po.totalCount += event.EntryCount
+	po.totalSize += event.TotalSize
+	po.draw(false)
+}
+
+func (po *progressObserver) EntryDone(event *rpf.EntryDoneEvent) {
+	po.doneCount++
+	po.doneSize += event.Size
+
+	if event.Err != nil {
+		po.failed++
+	}
+
+	po.draw(false)
+}
+
+func (po *progressObserver) draw(force bool) {
+	now := time.Now()
+	if !force && now.Sub(po.drawTime) < progressRedrawDelay {
+		return
+	}
+
+	po.drawTime = now
+
+	ratio := 0.0
+	if po.finished {
+		ratio = 1
+	} else if po.totalSize > 0 {
+		ratio = float64(po.doneSize) / float64(po.totalSize)
+	} else if po.totalCount > 0 {
+		ratio = float64(po.doneCount) / float64(po.totalCount)
+	}
+
+	if ratio > 1 {
+		ratio = 1
+	}
+
+	filled := int(ratio * progressBarWidth)
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+
+	elapsed := now.Sub(po.startTime)
+	throughput := float64(po.doneSize) / elapsed.Seconds()
+
+	eta := "--:--"
+	if ratio > 0 && ratio < 1 {
+		eta = formatDuration(time.Duration(float64(elapsed) / ratio * (1 - ratio)))
+	} else if ratio >= 1 {
+		eta = formatDuration(0)
+	}
+
+	line := fmt.Sprintf("[%s] %3.0f%% %d/%d entries %s/s ETA %s", bar, ratio*100,
+		po.doneCount, po.totalCount, formatSize(int64(throughput)), eta)
+
+	if po.failed > 0 {
+		line += fmt.Sprintf(" (%d failed)", po.failed)
+	}
+
+	fmt.Fprintf(po.writer, "\r%-80s", line)
+}
+
+// Draws the final state and moves to the next line
+func (po *progressObserver) finish() {
+	po.finished = true
+	po.close()
+}
+
+// Moves to the next line, keeping the bar where it stopped if extraction
+// failed. Does nothing after finish
+func (po *progressObserver) close() {
+	if po.closed {
+		return
+	}
+
+	po.closed = true
+	po.draw(true)
+	fmt.Fprintln(po.writer)
+}
+
+func formatDuration(duration time.Duration) string {
+	seconds := int(duration.Round(time.Second).Seconds())
+	return fmt.Sprintf("%02d:%02d", seconds/60, seconds%60)
+}
+
+func formatSize(size int64) string {
+	units := []string{"B", "KiB", "MiB", "GiB"}
+	value := float64(size)
+	unit := 0
+
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// ErrUnknownFormat is returned for an unsupported --format value
+var ErrUnknownFormat = errors.New("unknown output format, expected text, json or ndjson")
+
+const (
+	formatText   = "text"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+// Record kinds of structured output
+const (
+	recordEntry   = "entry"
+	recordTitle   = "title"
+	recordPack    = "pack"
+	recordInstall = "install"
+	recordKey     = "key"
+	recordSummary = "summary"
+)
+
+// A single extracted, decrypted or listed item
+type outputRecord struct {
+	Record      string  `json:"record"`
+	Pack        string  `json:"pack,omitempty"`
+	Path        string  `json:"path"`
+	Type        string  `json:"type,omitempty"`
+	ContentType string  `json:"contentType,omitempty"`
+	Size        int64   `json:"size"`
+	OnDiskSize  int64   `json:"onDiskSize"`
+	Offset      int64   `json:"offset,omitempty"`
+	Encrypted   bool    `json:"encrypted,omitempty"`
+	Output      string  `json:"output,omitempty"`
+	DurationMs  float64 `json:"durationMs"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// Header of a pack for the info command
+type packRecord struct {
+	Record     string `json:"record"`
+	Pack       string `json:"pack"`
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Version    int    `json:"version"`
+	Entries    uint32 `json:"entries"`
+	NameShift  uint8  `json:"nameShift"`
+	Encryption string `json:"encryption"`
+}
+
+// RGL installation for the discover command
+type installRecord struct {
+	Record string `json:"record"`
+	Path   string `json:"path"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Pack key for the keys command
+type keyRecord struct {
+	Record string `json:"record"`
+	Key    string `json:"key"`
+	Hash   string `json:"hash,omitempty"`
+
+	// Where the key comes from: explicit, launcher or recovered
+	Source   string `json:"source"`
+	Location string `json:"location,omitempty"`
+
+	Cached   bool `json:"cached"`
+	Imported bool `json:"imported,omitempty"`
+
+	// Cache file the key was taken from or imported into
+	Cache  string `json:"cache,omitempty"`
+	Export string `json:"export,omitempty"`
+}
+
+// Always the last record
+type summaryRecord struct {
+	Record     string  `json:"record"`
+	Command    string  `json:"command"`
+	Records    int     `json:"records"`
+	Failed     int     `json:"failed"`
+	Size       int64   `json:"size"`
+	DurationMs float64 `json:"durationMs"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// Writes records to stdout as they come for ndjson, or as a single array
+// at the end for json. Text output is printed by commands themselves
+type outputWriter struct {
+	format    string
+	encoder   *json.Encoder
+	records   []interface{}
+	startTime time.Time
+	count     int
+	failed    int
+	size      int64
+}
+
+func newOutputWriter(format string) (*outputWriter, error) {
+	switch format {
+	case "", formatText:
+		format = formatText
+	case formatJSON, formatNDJSON:
+	default:
+		return nil, ErrUnknownFormat
+	}
+
+	return &outputWriter{
+		format:    format,
+		encoder:   json.NewEncoder(os.Stdout),
+		startTime: time.Now(),
+	}, nil
+}
+
+func (ow *outputWriter) isText() bool {
+	return ow == nil || ow.format == formatText
+}
+
+func (ow *outputWriter) write(record interface{}) {
+	if ow.isText() {
+		return
+	}
+
+	if entry, ok := record.(*outputRecord); ok {
+		ow.count++
+		ow.size += entry.Size
+
+		if entry.Error != "" {
+			ow.failed++
+		}
+	} else {
+		ow.count++
+	}
+
+	if ow.format == formatNDJSON {
+		ow.encoder.Encode(record)
+		return
+	}
+
+	ow.records = append(ow.records, record)
+}
+
+// Writes the summary and flushes buffered records, err is the error the
+// command has failed with
+func (ow *outputWriter) finish(command string, err error) {
+	if ow.isText() {
+		return
+	}
+
+	summary := &summaryRecord{
+		Record:     recordSummary,
+		Command:    command,
+		Records:    ow.count,
+		Failed:     ow.failed,
+		Size:       ow.size,
+		DurationMs: getDurationMs(time.Since(ow.startTime)),
+	}
+
+	if err != nil {
+		summary.Error = err.Error()
+	}
+
+	ow.write(summary)
+
+	if ow.format == formatJSON {
+		if ow.records == nil {
+			ow.records = []interface{}{}
+		}
+
+		ow.encoder.SetIndent("", "  ")
+		ow.encoder.Encode(ow.records)
+	}
+}
+
+func getDurationMs(duration time.Duration) float64 {
+	return float64(duration.Microseconds()) / 1000
+}
+
+func getErrorString(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	return err.Error()
+}
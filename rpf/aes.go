@@ -0,0 +1,55 @@
+package rpf
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+// AESCrypto decrypts AES encrypted packs, like the ones used by RGL
+type AESCrypto struct {
+	Key    []byte
+	Cipher cipher.Block
+
+	// Set for the key found in launcher.exe, it only fits RPF7 packs of RGL
+	// and legacy packs need their own key
+	LauncherKey bool
+}
+
+// NewAESCrypto creates a decryptor for a 32 bytes AES key
+func NewAESCrypto(key []byte) (*AESCrypto, error) {
+	cipher, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AESCrypto{
+		Key:    key,
+		Cipher: cipher,
+	}, nil
+}
+
+func (aes *AESCrypto) decrypt(data []byte) []byte {
+	length := len(data) - len(data)%16
+	result := make([]byte, len(data))
+	blockSize := 16
+
+	for bs, be := 0, blockSize; bs < length; bs, be = bs+blockSize, be+blockSize {
+		aes.Cipher.Decrypt(result[bs:be], data[bs:be])
+	}
+
+	rest := data[length:]
+	if len(rest) > 0 {
+		result = append(result[:length], rest[:]...)
+	}
+
+	return result
+}
+
+// Older titles apply the same key several times in a row
+func (aes *AESCrypto) decryptRounds(data []byte, rounds int) []byte {
+	for i := 0; i < rounds; i++ {
+		data = aes.decrypt(data)
+	}
+
+	return data
+}
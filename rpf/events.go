@@ -0,0 +1,105 @@
+package rpf
+
+import (
+	"time"
+)
+
+// Reasons of EntrySkippedEvent
+const (
+	SkipReasonFilter = "filter"
+
+	// Nested pack past MaxDepth, it's written as a file instead
+	SkipReasonDepth = "depth"
+)
+
+// Observer receives events of Extract. Embed BaseObserver to handle only
+// some of them
+type Observer interface {
+	PackOpened(event *PackOpenedEvent)
+	EntryStarted(event *EntryStartedEvent)
+	EntryDone(event *EntryDoneEvent)
+	EntrySkipped(event *EntrySkippedEvent)
+	Error(event *ErrorEvent)
+}
+
+// BaseObserver ignores every event
+type BaseObserver struct{}
+
+func (BaseObserver) PackOpened(event *PackOpenedEvent)     {}
+func (BaseObserver) EntryStarted(event *EntryStartedEvent) {}
+func (BaseObserver) EntryDone(event *EntryDoneEvent)       {}
+func (BaseObserver) EntrySkipped(event *EntrySkippedEvent) {}
+func (BaseObserver) Error(event *ErrorEvent)               {}
+
+// PackOpenedEvent is sent before extraction of a pack, nested ones included
+type PackOpenedEvent struct {
+	Pack *PackFile
+
+	// Path of the pack entry prefixed with paths of parent packs, empty
+	// for the top pack
+	Path string
+
+	// Entries that are going to be extracted and their total size, without
+	// content of nested packs
+	EntryCount int
+	TotalSize  int64
+}
+
+// EntryStartedEvent is sent before an entry is read
+type EntryStartedEvent struct {
+	// Path of the entry, prefixed with paths of parent packs
+	Path string
+
+	// One of EntryType constants
+	Type string
+
+	Size int64
+}
+
+// EntryDoneEvent is sent after an entry is extracted, failed ones included
+type EntryDoneEvent struct {
+	// Path of the entry, prefixed with paths of parent packs
+	Path string
+
+	// Path of the written file, with a guessed extension if it had none
+	OutPath string
+
+	// One of EntryType constants
+	Type string
+
+	// Content type guessed from magic, see DetectContentType
+	ContentType string
+
+	Size       int64
+	OnDiskSize int64
+
+	// Bytes actually written into OutPath
+	Written int64
+
+	Duration time.Duration
+	Err      error
+}
+
+// EntrySkippedEvent is sent for an entry that is not extracted
+type EntrySkippedEvent struct {
+	// Path of the entry, prefixed with paths of parent packs
+	Path string
+
+	// One of SkipReason constants
+	Reason string
+}
+
+// ErrorEvent is sent for every failure, Err is usually an ExtractError
+type ErrorEvent struct {
+	// Path of the entry, prefixed with paths of parent packs
+	Path string
+	Err  error
+}
+
+func (eo *ExtractOptions) getObserver() Observer {
+	if eo == nil || eo.Observer == nil {
+		return BaseObserver{}
+	}
+
+	return eo.Observer
+}
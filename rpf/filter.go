@@ -0,0 +1,144 @@
+package rpf
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+const regexPatternPrefix = "re:"
+
+// EntryFilter selects entries by their root relative paths and sizes.
+// Patterns are globs, or regular expressions when prefixed with "re:".
+// Globs without a slash are matched against the name only, "**" matches
+// across directories and "**/" also matches no directory at all. Both
+// kinds ignore case, like names in packs
+type EntryFilter struct {
+	Include    []*regexp.Regexp
+	Exclude    []*regexp.Regexp
+	Extensions []string
+
+	// Uncompressed size limits, MaxSize is ignored if zero
+	MinSize int64
+	MaxSize int64
+}
+
+// AddInclude adds a pattern entries have to match, any of them
+func (ef *EntryFilter) AddInclude(pattern string) error {
+	re, err := compileFilterPattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	ef.Include = append(ef.Include, re)
+	return nil
+}
+
+// AddExclude adds a pattern entries must not match
+func (ef *EntryFilter) AddExclude(pattern string) error {
+	re, err := compileFilterPattern(pattern)
+	if err != nil {
+		return err
+	}
+
+	ef.Exclude = append(ef.Exclude, re)
+	return nil
+}
+
+// AddExtension adds an extension entries have to end with, any of them
+func (ef *EntryFilter) AddExtension(extension string) {
+	extension = strings.ToLower(extension)
+	if !strings.HasPrefix(extension, ".") {
+		extension = "." + extension
+	}
+
+	ef.Extensions = append(ef.Extensions, extension)
+}
+
+// Match reports whether an entry with given path and size passes the filter
+func (ef *EntryFilter) Match(entryPath string, size int64) bool {
+	if size < ef.MinSize || (ef.MaxSize > 0 && size > ef.MaxSize) {
+		return false
+	}
+
+	if len(ef.Extensions) > 0 {
+		extension := strings.ToLower(path.Ext(entryPath))
+		found := false
+
+		for _, allowed := range ef.Extensions {
+			if extension == allowed {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	if len(ef.Include) > 0 && !matchAnyPattern(ef.Include, entryPath) {
+		return false
+	}
+
+	return !matchAnyPattern(ef.Exclude, entryPath)
+}
+
+func matchAnyPattern(patterns []*regexp.Regexp, entryPath string) bool {
+	for _, re := range patterns {
+		if re.MatchString(entryPath) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func compileFilterPattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, regexPatternPrefix) {
+		return regexp.Compile("(?i)" + strings.TrimPrefix(pattern, regexPatternPrefix))
+	}
+
+	return regexp.Compile(globToRegex(pattern))
+}
+
+// Case-insensitive, like names in packs
+func globToRegex(pattern string) string {
+	pattern = strings.Trim(strings.ReplaceAll(pattern, "\\", "/"), "/")
+
+	var builder strings.Builder
+	builder.WriteString("(?i)")
+
+	// Name only patterns may match in any directory
+	if !strings.Contains(pattern, "/") {
+		builder.WriteString("(^|/)")
+	} else {
+		builder.WriteString("^")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+
+		switch c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				// Any directories, none included
+				builder.WriteString("(.*/)?")
+				i += 2
+			} else if i+1 < len(pattern) && pattern[i+1] == '*' {
+				builder.WriteString(".*")
+				i++
+			} else {
+				builder.WriteString("[^/]*")
+			}
+		case '?':
+			builder.WriteString("[^/]")
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	builder.WriteString("$")
+
+	return builder.String()
+}
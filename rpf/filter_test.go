@@ -0,0 +1,81 @@
+package rpf
+
+import (
+	"testing"
+)
+
+func TestFilterPatterns(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		entryPath string
+		match     bool
+	}{
+		{"*.json", "a.json", true},
+		{"*.json", "dir/sub/a.json", true},
+		{"*.json", "a.json.bak", false},
+		{"*.JSON", "dir/A.json", true},
+		{"a?.js", "dir/ab.js", true},
+		{"a?.js", "dir/a/.js", false},
+		{"dir/*.js", "dir/a.js", true},
+		{"dir/*.js", "dir/sub/a.js", false},
+		{"dir/*.js", "other/dir/a.js", false},
+		{"**/*.json", "a.json", true},
+		{"**/*.json", "dir/sub/a.json", true},
+		{"dir/**/*.js", "dir/a.js", true},
+		{"dir/**/*.js", "dir/sub/deep/a.js", true},
+		{"dir/**", "dir/sub/a.js", true},
+		{"dir/**", "other/a.js", false},
+		{"\\dir\\*.js", "dir/a.js", true},
+		{"a+b.txt", "a+b.txt", true},
+		{"a+b.txt", "aab.txt", false},
+		{"re:^locales/", "locales/en.json", true},
+		{"re:^locales/", "LOCALES/en.json", true},
+		{"re:^locales/", "dir/locales/en.json", false},
+		{"re:\\.js$", "a.json", false},
+	}
+
+	for _, test := range tests {
+		re, err := compileFilterPattern(test.pattern)
+		if err != nil {
+			t.Errorf("compileFilterPattern(%q): %v", test.pattern, err)
+			continue
+		}
+
+		if match := re.MatchString(test.entryPath); match != test.match {
+			t.Errorf("%q matches %q = %v, want %v", test.pattern, test.entryPath, match, test.match)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	filter := &EntryFilter{MinSize: 10, MaxSize: 100}
+	filter.AddExtension("JS")
+
+	if err := filter.AddInclude("dir/**"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := filter.AddExclude("*.min.js"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		entryPath string
+		size      int64
+		match     bool
+	}{
+		{"dir/a.js", 50, true},
+		{"dir/sub/A.JS", 10, true},
+		{"dir/a.js", 9, false},
+		{"dir/a.js", 101, false},
+		{"dir/a.json", 50, false},
+		{"other/a.js", 50, false},
+		{"dir/a.min.js", 50, false},
+	}
+
+	for _, test := range tests {
+		if match := filter.Match(test.entryPath, test.size); match != test.match {
+			t.Errorf("Match(%q, %d) = %v, want %v", test.entryPath, test.size, match, test.match)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package rpf
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"errors"
+	"os"
+
+	"github.com/Disquse/RGLExtractor/internal/iostream"
+)
+
+// ErrNotAESEncrypted is returned when a pack can't tell whether a key is right
+var ErrNotAESEncrypted = errors.New("rpf: pack is not encrypted with AES")
+
+// KeyChecker tries keys against the TOC of an AES encrypted pack, to find
+// the key when it can't be recognized by its hash
+type KeyChecker struct {
+	packFile *PackFile
+	file     *os.File
+
+	// Encrypted root entry, the first one of the TOC
+	rootEntry []byte
+}
+
+// NewKeyChecker opens a pack on disk for CheckKey, it stays open until Close
+func NewKeyChecker(filePath string) (*KeyChecker, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	checker, err := newKeyChecker(filePath, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return checker, nil
+}
+
+func newKeyChecker(filePath string, file *os.File) (*KeyChecker, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	packFile := &PackFile{
+		Path:   filePath,
+		Source: file,
+		Size:   info.Size(),
+		reader: iostream.NewReaderAt(file),
+		base:   file,
+	}
+
+	header, err := packFile.readPackHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	if header.DecryptionTag != packEncryptionAES || header.EntryCount == 0 {
+		return nil, ErrNotAESEncrypted
+	}
+
+	packFile.Header = header
+
+	rootEntry, err := packFile.readPackData(16, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyChecker{
+		packFile:  packFile,
+		file:      file,
+		rootEntry: rootEntry,
+	}, nil
+}
+
+// CheckKey tells whether the key decrypts the TOC into valid entries. The
+// root entry is checked first, the whole TOC only if it's a directory
+func (kc *KeyChecker) CheckKey(key []byte) bool {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return false
+	}
+
+	decrypted := make([]byte, aes.BlockSize)
+	block.Decrypt(decrypted, kc.rootEntry)
+
+	if !kc.isRootEntry(decrypted) {
+		return false
+	}
+
+	crypto, err := NewAESCrypto(key)
+	if err != nil {
+		return false
+	}
+
+	packFile := kc.packFile
+	_, err = ReadPackFile(packFile.Path, packFile.Source, packFile.Size, crypto, nil)
+
+	// A truncated pack still has a valid TOC
+	return err == nil || errors.Is(err, ErrDataRange)
+}
+
+// Root entry is an unnamed directory with its children in the TOC
+func (kc *KeyChecker) isRootEntry(decrypted []byte) bool {
+	first := binary.LittleEndian.Uint64(decrypted)
+	offset := uint32(((first >> 40) & 0x7FFFFF) << 9)
+
+	if offset != packDirectoryOffset || first&0xFFFF != 0 {
+		return false
+	}
+
+	startIndex := uint64(binary.LittleEndian.Uint32(decrypted[8:]))
+	entryCount := uint64(binary.LittleEndian.Uint32(decrypted[12:]))
+
+	if entryCount > 0 && startIndex == 0 {
+		return false
+	}
+
+	return startIndex+entryCount <= uint64(kc.packFile.Header.EntryCount)
+}
+
+// Close closes the pack file
+func (kc *KeyChecker) Close() error {
+	return kc.file.Close()
+}
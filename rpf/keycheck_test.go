@@ -0,0 +1,49 @@
+package rpf
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestPack(t *testing.T, data []byte) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "test.rpf")
+	if err := os.WriteFile(filePath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return filePath
+}
+
+func TestKeyChecker(t *testing.T) {
+	crypto := newTestCrypto(t, 1)
+	pack := makeRPF7Pack(testFiles, crypto.Key)
+
+	// A truncated pack still tells the right key
+	for _, data := range [][]byte{pack, pack[:len(pack)-512]} {
+		checker, err := NewKeyChecker(writeTestPack(t, data))
+		if err != nil {
+			t.Fatalf("NewKeyChecker: %v", err)
+		}
+
+		if !checker.CheckKey(crypto.Key) {
+			t.Error("right key is rejected")
+		}
+
+		if checker.CheckKey(newTestCrypto(t, 2).Key) {
+			t.Error("wrong key is accepted")
+		}
+
+		checker.Close()
+	}
+}
+
+func TestKeyCheckerPlainPack(t *testing.T) {
+	_, err := NewKeyChecker(writeTestPack(t, makeRPF7Pack(testFiles, nil)))
+	if !errors.Is(err, ErrNotAESEncrypted) {
+		t.Errorf("NewKeyChecker = %v, want %v", err, ErrNotAESEncrypted)
+	}
+}
@@ -0,0 +1,299 @@
+package rpf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	ErrLegacyTOC = errors.New("rpf: legacy pack TOC is smaller than its entries")
+	ErrLegacyKey = errors.New("rpf: encrypted legacy pack needs its own key, the launcher one doesn't fit")
+)
+
+const (
+	legacyHeaderSize   = 20
+	legacyTocOffset    = 0x800
+	legacyEntrySize    = 16
+	legacyCryptoRounds = 16
+
+	rpf6HeaderSize = 16
+	rpf6TocOffset  = 0x10
+	rpf6EntrySize  = 20
+)
+
+const (
+	legacyDirectoryFlag  = 0x80000000
+	legacyResourceFlags  = 0xC0000000
+	legacyCompressedFlag = 0x40000000
+
+	rpf6ResourceFlag = 0x80000000
+)
+
+// RPF0 (Table Tennis), RPF2 (GTA IV), RPF3 (GTA IV audio, MCLA) and
+// RPF4 (Max Payne 3). All of them store a header, then a TOC at 0x800 made
+// of 16 bytes entries. RPF0 and RPF2 have a name table after the entries,
+// later versions only keep name hashes. RPF4 stores offsets in 8 byte units
+type legacyParser struct {
+	order       binary.ByteOrder
+	hashedNames bool
+	offsetShift uint
+}
+
+// RPF6 (Red Dead Redemption). A 16 bytes header followed by a TOC made of
+// 20 bytes entries with hashed names and offsets in 8 byte units. Not used
+// by newPackParser until the layout is checked against a retail pack
+type rpf6Parser struct {
+	order binary.ByteOrder
+}
+
+func (lp *legacyParser) readPackHeader(fi *PackFile) (*PackHeader, error) {
+	data, err := fi.readPackData(0, legacyHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := lp.order.Uint32(data[0:])
+	tocSize := lp.order.Uint32(data[4:])
+	entryCount := lp.order.Uint32(data[8:])
+	encrypted := lp.order.Uint32(data[16:])
+
+	if uint64(entryCount)*legacyEntrySize > uint64(tocSize) {
+		return nil, ErrLegacyTOC
+	}
+
+	packHeader := PackHeader{
+		Magic:         magic,
+		EntryCount:    entryCount,
+		NamesLength:   tocSize - entryCount*legacyEntrySize,
+		DecryptionTag: encrypted,
+	}
+
+	return &packHeader, nil
+}
+
+func (lp *legacyParser) readPackEntries(fi *PackFile) ([]*PackEntry, []byte, error) {
+	entryCount := int(fi.Header.EntryCount)
+	tocSize := entryCount*legacyEntrySize + int(fi.Header.NamesLength)
+
+	toc, err := fi.readPackData(legacyTocOffset, tocSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	toc, err = fi.decryptLegacyData(toc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]*PackEntry, entryCount)
+
+	for i := 0; i < entryCount; i++ {
+		data := toc[i*legacyEntrySize:]
+
+		name := lp.order.Uint32(data[0:])
+		size := lp.order.Uint32(data[4:])
+		offset := lp.order.Uint32(data[8:])
+		flags := lp.order.Uint32(data[12:])
+
+		packEntry := &PackEntry{
+			NameOffset: name,
+		}
+
+		// Directories have the top bit of the size set, then the index of
+		// the first child and child count, see IsDirectory in TOCEntry.cs
+		// of SparkIV (RPFLib/Common)
+		if size&legacyDirectoryFlag != 0 {
+			packEntry.Offset = packDirectoryOffset
+			packEntry.second = offset
+			packEntry.third = flags & 0xFFFFFFF
+		} else if flags&legacyResourceFlags == legacyResourceFlags {
+			// Lowest byte of the offset is a resource type
+			packEntry.Offset = (offset & 0x7FFFFF00) << lp.offsetShift
+			packEntry.OnDiskSize = size
+			packEntry.Resource = true
+			packEntry.second = flags
+		} else {
+			packEntry.Offset = offset << lp.offsetShift
+			packEntry.second = size
+
+			if flags&legacyCompressedFlag != 0 {
+				packEntry.OnDiskSize = flags & 0x3FFFFFFF
+			}
+		}
+
+		entries[i] = packEntry
+	}
+
+	if lp.hashedNames {
+		names := getHashedNames(entries)
+		fi.Header.NamesLength = uint32(len(names))
+
+		return entries, names, nil
+	}
+
+	return entries, toc[entryCount*legacyEntrySize:], nil
+}
+
+func (lp *legacyParser) readPackEntryContent(fi *PackFile, packEntry *PackEntry) ([]byte, error) {
+	return fi.readLegacyContent(packEntry)
+}
+
+func (lp *legacyParser) getEntryOffset(index int) int64 {
+	return legacyTocOffset + int64(index)*legacyEntrySize
+}
+
+func (rp *rpf6Parser) readPackHeader(fi *PackFile) (*PackHeader, error) {
+	data, err := fi.readPackData(0, rpf6HeaderSize)
+	if err != nil {
+		return nil, err
+	}
+
+	packHeader := PackHeader{
+		Magic:         rp.order.Uint32(data[0:]),
+		EntryCount:    rp.order.Uint32(data[4:]),
+		DecryptionTag: rp.order.Uint32(data[12:]),
+	}
+
+	return &packHeader, nil
+}
+
+func (rp *rpf6Parser) readPackEntries(fi *PackFile) ([]*PackEntry, []byte, error) {
+	entryCount := int(fi.Header.EntryCount)
+
+	toc, err := fi.readPackData(rpf6TocOffset, entryCount*rpf6EntrySize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	toc, err = fi.decryptLegacyData(toc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]*PackEntry, entryCount)
+
+	for i := 0; i < entryCount; i++ {
+		data := toc[i*rpf6EntrySize:]
+
+		name := rp.order.Uint32(data[0:])
+		onDiskSize := rp.order.Uint32(data[4:])
+		offset := rp.order.Uint32(data[8:])
+		size := rp.order.Uint32(data[12:])
+		flags := rp.order.Uint32(data[16:])
+
+		packEntry := &PackEntry{
+			NameOffset: name,
+		}
+
+		// Directories are assumed to have the top bit of the offset set,
+		// it's never used by offsets since they are stored in 8 byte units
+		if offset&legacyDirectoryFlag != 0 {
+			packEntry.Offset = packDirectoryOffset
+			packEntry.second = size
+			packEntry.third = flags & 0xFFFFFFF
+		} else if flags&rpf6ResourceFlag != 0 {
+			// Lowest byte of the offset is a resource type
+			packEntry.Offset = (offset & 0x7FFFFF00) << 3
+			packEntry.OnDiskSize = onDiskSize
+			packEntry.Resource = true
+			packEntry.second = flags
+		} else {
+			packEntry.Offset = offset << 3
+			packEntry.second = size
+
+			if flags&legacyCompressedFlag != 0 {
+				packEntry.OnDiskSize = onDiskSize
+			}
+		}
+
+		entries[i] = packEntry
+	}
+
+	names := getHashedNames(entries)
+	fi.Header.NamesLength = uint32(len(names))
+
+	return entries, names, nil
+}
+
+func (rp *rpf6Parser) readPackEntryContent(fi *PackFile, packEntry *PackEntry) ([]byte, error) {
+	return fi.readLegacyContent(packEntry)
+}
+
+func (rp *rpf6Parser) getEntryOffset(index int) int64 {
+	return rpf6TocOffset + int64(index)*rpf6EntrySize
+}
+
+// Only TOC is encrypted in legacy packs. GTA IV and Max Payne 3 each
+// use a key of their own, so the key has to be given explicitly
+func (fi *PackFile) decryptLegacyData(data []byte) ([]byte, error) {
+	if fi.Header.DecryptionTag == 0 {
+		return data, nil
+	}
+
+	if fi.Crypto == nil || fi.Crypto.LauncherKey {
+		return nil, ErrLegacyKey
+	}
+
+	return fi.Crypto.decryptRounds(data, legacyCryptoRounds), nil
+}
+
+// Legacy resources already contain their header, so they are written as is.
+// Compressed binaries use zlib instead of raw deflate
+func (fi *PackFile) readLegacyContent(packEntry *PackEntry) ([]byte, error) {
+	if packEntry.IsResource() {
+		return fi.readPackData(int64(packEntry.Offset), int(packEntry.OnDiskSize))
+	}
+
+	binarySize := packEntry.GetBinarySize()
+
+	if packEntry.OnDiskSize == 0 {
+		return fi.readPackData(int64(packEntry.Offset), binarySize)
+	}
+
+	if err := packEntry.validateCompressedSize(binarySize); err != nil {
+		return nil, err
+	}
+
+	entryContent, err := fi.readPackData(int64(packEntry.Offset), int(packEntry.OnDiskSize))
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(entryContent))
+	if err != nil {
+		return nil, err
+	}
+
+	defer reader.Close()
+
+	decompressed := make([]byte, binarySize)
+
+	if _, err := io.ReadFull(reader, decompressed); err != nil {
+		return nil, err
+	}
+
+	return decompressed, nil
+}
+
+// Builds a name table out of name hashes, root entry stays unnamed
+func getHashedNames(entries []*PackEntry) []byte {
+	var names []byte
+
+	for i, packEntry := range entries {
+		name := ""
+		if i > 0 {
+			name = fmt.Sprintf("0x%08X", packEntry.NameOffset)
+		}
+
+		packEntry.NameOffset = uint32(len(names))
+
+		names = append(names, name...)
+		names = append(names, 0)
+	}
+
+	return names
+}
@@ -0,0 +1,101 @@
+package rpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+const legacyTestDataOffset = 0x1000
+
+// Builds an RPF2 pack with a root directory holding a single file
+func makeRPF2Pack(content []byte, encrypted bool) []byte {
+	order := binary.LittleEndian
+	names := []byte("\x00file.txt\x00")
+
+	toc := make([]byte, 2*legacyEntrySize)
+
+	// Root directory, size has the directory flag
+	order.PutUint32(toc[4:], legacyDirectoryFlag)
+	order.PutUint32(toc[8:], 1)
+	order.PutUint32(toc[12:], 1)
+
+	order.PutUint32(toc[16:], 1)
+	order.PutUint32(toc[20:], uint32(len(content)))
+	order.PutUint32(toc[24:], legacyTestDataOffset)
+
+	toc = append(toc, names...)
+
+	pack := make([]byte, legacyTestDataOffset+len(content))
+	order.PutUint32(pack[0:], packMagic2)
+	order.PutUint32(pack[4:], uint32(len(toc)))
+	order.PutUint32(pack[8:], 2)
+
+	if encrypted {
+		order.PutUint32(pack[16:], 1)
+	}
+
+	copy(pack[legacyTocOffset:], toc)
+	copy(pack[legacyTestDataOffset:], content)
+
+	return pack
+}
+
+func readTestPack(t *testing.T, data []byte, entryPath string) []byte {
+	t.Helper()
+
+	packFile, err := ReadPackFile("test.rpf", bytes.NewReader(data), int64(len(data)), nil, nil)
+	if err != nil {
+		t.Fatalf("ReadPackFile: %v", err)
+	}
+
+	packEntry, err := packFile.FindEntry(entryPath)
+	if err != nil {
+		t.Fatalf("FindEntry(%q): %v", entryPath, err)
+	}
+
+	content, err := packFile.ReadEntryContent(packEntry)
+	if err != nil {
+		t.Fatalf("ReadEntryContent: %v", err)
+	}
+
+	return content
+}
+
+func TestReadRPF2(t *testing.T) {
+	content := []byte("hello")
+
+	if got := readTestPack(t, makeRPF2Pack(content, false), "file.txt"); !bytes.Equal(got, content) {
+		t.Errorf("content = %q, want %q", got, content)
+	}
+}
+
+func TestRPF6NotSupported(t *testing.T) {
+	data := make([]byte, legacyTestDataOffset)
+	binary.BigEndian.PutUint32(data, packMagic6)
+
+	// Directory layout of RPF6 is not checked yet, so it's not opened
+	_, err := ReadPackFile("test.rpf", bytes.NewReader(data), int64(len(data)), nil, nil)
+	if !errors.Is(err, ErrFileType) {
+		t.Errorf("ReadPackFile = %v, want %v", err, ErrFileType)
+	}
+}
+
+func TestLegacyLauncherKey(t *testing.T) {
+	data := makeRPF2Pack([]byte("hello"), true)
+
+	crypto, err := NewAESCrypto(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	crypto.LauncherKey = true
+
+	for _, crypto := range []*AESCrypto{nil, crypto} {
+		_, err := ReadPackFile("test.rpf", bytes.NewReader(data), int64(len(data)), crypto, nil)
+		if !errors.Is(err, ErrLegacyKey) {
+			t.Errorf("ReadPackFile = %v, want %v", err, ErrLegacyKey)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package rpf
+
+import (
+	"sort"
+	"strings"
+)
+
+// Entry types reported by ListEntries
+const (
+	EntryTypeDirectory = "directory"
+	EntryTypeBinary    = "binary"
+	EntryTypeResource  = "resource"
+)
+
+// EntryInfo describes an entry for listings
+type EntryInfo struct {
+	Index int
+	Path  string
+	Type  string
+
+	// Uncompressed size of a file, or size of resource pages
+	Size int64
+
+	// Size of entry data in the pack file
+	OnDiskSize int64
+
+	Offset    int64
+	Encrypted bool
+}
+
+// ListEntries returns every entry but the root, sorted by path so that
+// children of a directory follow it
+func (fi *PackFile) ListEntries() ([]*EntryInfo, error) {
+	if !fi.isReadable() {
+		return nil, ErrNotReadable
+	}
+
+	entryPaths, err := fi.BuildEntryPathMap()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]*EntryInfo, 0, len(entryPaths))
+
+	for i, entryPath := range entryPaths {
+		infos = append(infos, fi.GetEntryInfo(fi.Entries[i], entryPath))
+	}
+
+	// Separator sorts before any other character, so directories
+	// are immediately followed by their content
+	sort.Slice(infos, func(a, b int) bool {
+		pathA := strings.ReplaceAll(infos[a].Path, "/", "\x00")
+		pathB := strings.ReplaceAll(infos[b].Path, "/", "\x00")
+
+		return pathA < pathB
+	})
+
+	return infos, nil
+}
+
+// GetEntryInfo describes a single entry, entryPath is relative to the pack
+func (fi *PackFile) GetEntryInfo(packEntry *PackEntry, entryPath string) *EntryInfo {
+	info := &EntryInfo{
+		Index: packEntry.GetIndex(),
+		Path:  entryPath,
+	}
+
+	if packEntry.IsDirectory() {
+		info.Type = EntryTypeDirectory
+		return info
+	}
+
+	info.OnDiskSize = int64(packEntry.GetStoredSize())
+	info.Offset = int64(packEntry.Offset)
+	info.Encrypted = fi.isEntryEncrypted(packEntry, entryPath)
+
+	info.Size = fi.getEntrySize(packEntry)
+
+	if packEntry.IsResource() {
+		info.Type = EntryTypeResource
+	} else {
+		info.Type = EntryTypeBinary
+	}
+
+	return info
+}
+
+// Legacy packs never encrypt entries, only their TOC
+func (fi *PackFile) isEntryEncrypted(packEntry *PackEntry, entryPath string) bool {
+	if fi.Header.Magic != packMagic7 {
+		return false
+	}
+
+	switch fi.Header.DecryptionTag {
+	case packEncryptionNone, packEncryptionOpen:
+		return false
+	}
+
+	if packEntry.IsResource() {
+		return isEncryptedResource(entryPath)
+	}
+
+	return packEntry.GetBinaryDecryptionTag() == 1
+}
@@ -0,0 +1,164 @@
+package rpf
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+)
+
+var (
+	ErrNGKeys   = errors.New("ng: invalid key file")
+	ErrNGTables = errors.New("ng: invalid decrypt tables file")
+)
+
+const (
+	// Same file names and layout as CodeWalker and friends use
+	ngKeyFileName    = "gtav_ng_key.dat"
+	ngTablesFileName = "gtav_ng_decrypt_tables.dat"
+
+	ngKeyCount   = 101
+	ngKeyLength  = 272 // 17 rounds, 4 uints per round
+	ngRoundCount = 17
+	ngTableCount = 16
+)
+
+// NGCrypto decrypts GTA V packs encrypted with NG
+type NGCrypto struct {
+	// 101 keys, each split into 17 round keys
+	Keys [ngKeyCount][ngRoundCount][4]uint32
+
+	// 16 lookup tables for each of 17 rounds
+	Tables [ngRoundCount][ngTableCount][256]uint32
+}
+
+// LoadNGCrypto loads gtav_ng_key.dat and gtav_ng_decrypt_tables.dat
+// from keysPath
+func LoadNGCrypto(keysPath string) (*NGCrypto, error) {
+	keys, err := ioutil.ReadFile(filepath.Join(keysPath, ngKeyFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(keys) != ngKeyCount*ngKeyLength {
+		return nil, ErrNGKeys
+	}
+
+	tables, err := ioutil.ReadFile(filepath.Join(keysPath, ngTablesFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tables) != ngRoundCount*ngTableCount*256*4 {
+		return nil, ErrNGTables
+	}
+
+	ng := &NGCrypto{}
+
+	for k := 0; k < ngKeyCount; k++ {
+		for r := 0; r < ngRoundCount; r++ {
+			for i := 0; i < 4; i++ {
+				pos := k*ngKeyLength + (r*4+i)*4
+				ng.Keys[k][r][i] = binary.LittleEndian.Uint32(keys[pos:])
+			}
+		}
+	}
+
+	pos := 0
+	for r := 0; r < ngRoundCount; r++ {
+		for t := 0; t < ngTableCount; t++ {
+			for i := 0; i < 256; i++ {
+				ng.Tables[r][t][i] = binary.LittleEndian.Uint32(tables[pos:])
+				pos += 4
+			}
+		}
+	}
+
+	return ng, nil
+}
+
+// Keys are selected by the name of the pack or entry and its size
+func (ng *NGCrypto) getKeyIndex(name string, length uint32) int {
+	return int((getNameHash(name) + length + (101 - 40)) % ngKeyCount)
+}
+
+func (ng *NGCrypto) decrypt(data []byte, name string, length uint32) []byte {
+	key := &ng.Keys[ng.getKeyIndex(name, length)]
+
+	length16 := len(data) - len(data)%16
+	result := make([]byte, len(data))
+
+	for bs := 0; bs < length16; bs += 16 {
+		ng.decryptBlock(result[bs:bs+16], data[bs:bs+16], key)
+	}
+
+	// Trailing bytes are stored as is
+	copy(result[length16:], data[length16:])
+
+	return result
+}
+
+func (ng *NGCrypto) decryptBlock(dst []byte, src []byte, key *[ngRoundCount][4]uint32) {
+	var block [16]byte
+	copy(block[:], src)
+
+	ng.decryptRoundA(&block, &key[0], &ng.Tables[0])
+	ng.decryptRoundA(&block, &key[1], &ng.Tables[1])
+
+	for r := 2; r < ngRoundCount-1; r++ {
+		ng.decryptRoundB(&block, &key[r], &ng.Tables[r])
+	}
+
+	ng.decryptRoundA(&block, &key[ngRoundCount-1], &ng.Tables[ngRoundCount-1])
+
+	copy(dst, block[:])
+}
+
+func (ng *NGCrypto) decryptRoundA(block *[16]byte, key *[4]uint32, table *[ngTableCount][256]uint32) {
+	x1 := table[0][block[0]] ^ table[1][block[1]] ^ table[2][block[2]] ^ table[3][block[3]] ^ key[0]
+	x2 := table[4][block[4]] ^ table[5][block[5]] ^ table[6][block[6]] ^ table[7][block[7]] ^ key[1]
+	x3 := table[8][block[8]] ^ table[9][block[9]] ^ table[10][block[10]] ^ table[11][block[11]] ^ key[2]
+	x4 := table[12][block[12]] ^ table[13][block[13]] ^ table[14][block[14]] ^ table[15][block[15]] ^ key[3]
+
+	binary.LittleEndian.PutUint32(block[0:], x1)
+	binary.LittleEndian.PutUint32(block[4:], x2)
+	binary.LittleEndian.PutUint32(block[8:], x3)
+	binary.LittleEndian.PutUint32(block[12:], x4)
+}
+
+func (ng *NGCrypto) decryptRoundB(block *[16]byte, key *[4]uint32, table *[ngTableCount][256]uint32) {
+	x1 := table[0][block[0]] ^ table[7][block[7]] ^ table[10][block[10]] ^ table[13][block[13]] ^ key[0]
+	x2 := table[1][block[1]] ^ table[4][block[4]] ^ table[11][block[11]] ^ table[14][block[14]] ^ key[1]
+	x3 := table[2][block[2]] ^ table[5][block[5]] ^ table[8][block[8]] ^ table[15][block[15]] ^ key[2]
+	x4 := table[3][block[3]] ^ table[6][block[6]] ^ table[9][block[9]] ^ table[12][block[12]] ^ key[3]
+
+	binary.LittleEndian.PutUint32(block[0:], x1)
+	binary.LittleEndian.PutUint32(block[4:], x2)
+	binary.LittleEndian.PutUint32(block[8:], x3)
+	binary.LittleEndian.PutUint32(block[12:], x4)
+}
+
+// Jenkins one-at-a-time hash, case and slash insensitive
+func getNameHash(name string) uint32 {
+	var hash uint32
+
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		} else if c == '\\' {
+			c = '/'
+		}
+
+		hash += uint32(c)
+		hash += hash << 10
+		hash ^= hash >> 6
+	}
+
+	hash += hash << 3
+	hash ^= hash >> 11
+	hash += hash << 15
+
+	return hash
+}
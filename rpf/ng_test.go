@@ -0,0 +1,114 @@
+package rpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNameHash(t *testing.T) {
+	tests := []struct {
+		name string
+		hash uint32
+	}{
+		{"", 0},
+		{"a", 0xCA2E9442},
+		{"launcher.rpf", 0xD352F469},
+		{"Dir\\A.RPF", 0xA752347A},
+		{"dir/a.rpf", 0xA752347A},
+	}
+
+	for _, test := range tests {
+		if hash := getNameHash(test.name); hash != test.hash {
+			t.Errorf("getNameHash(%q) = 0x%08X, want 0x%08X", test.name, hash, test.hash)
+		}
+	}
+}
+
+func TestNGKeyIndex(t *testing.T) {
+	ng := &NGCrypto{}
+
+	if index := ng.getKeyIndex("launcher.rpf", 1000); index != 90 {
+		t.Errorf("getKeyIndex = %d, want 90", index)
+	}
+}
+
+func writeNGFiles(t *testing.T, keys []byte, tables []byte) string {
+	t.Helper()
+
+	keysPath := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(keysPath, ngKeyFileName), keys, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(keysPath, ngTablesFileName), tables, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return keysPath
+}
+
+func TestLoadNGCrypto(t *testing.T) {
+	keys := make([]byte, ngKeyCount*ngKeyLength)
+	for i := 0; i < len(keys); i += 4 {
+		binary.LittleEndian.PutUint32(keys[i:], uint32(i/4))
+	}
+
+	tables := make([]byte, ngRoundCount*ngTableCount*256*4)
+	for i := 0; i < len(tables); i += 4 {
+		binary.LittleEndian.PutUint32(tables[i:], uint32(i/4))
+	}
+
+	ng, err := LoadNGCrypto(writeNGFiles(t, keys, tables))
+	if err != nil {
+		t.Fatalf("LoadNGCrypto: %v", err)
+	}
+
+	// Keys are 17 rounds of 4 uints each, tables 16 of 256 uints per round
+	if value := ng.Keys[2][3][1]; value != 2*ngRoundCount*4+3*4+1 {
+		t.Errorf("Keys[2][3][1] = %d", value)
+	}
+
+	if value := ng.Tables[2][3][4]; value != (2*ngTableCount+3)*256+4 {
+		t.Errorf("Tables[2][3][4] = %d", value)
+	}
+
+	_, err = LoadNGCrypto(writeNGFiles(t, keys[:len(keys)-1], tables))
+	if !errors.Is(err, ErrNGKeys) {
+		t.Errorf("LoadNGCrypto with a short key file = %v, want %v", err, ErrNGKeys)
+	}
+
+	_, err = LoadNGCrypto(writeNGFiles(t, keys, tables[:len(tables)-1]))
+	if !errors.Is(err, ErrNGTables) {
+		t.Errorf("LoadNGCrypto with short tables = %v, want %v", err, ErrNGTables)
+	}
+}
+
+func TestNGDecrypt(t *testing.T) {
+	ng := &NGCrypto{}
+
+	// With empty tables every round only applies its key, so a block
+	// decrypts into the last round key of the selected key
+	index := ng.getKeyIndex("launcher.rpf", 1000)
+	ng.Keys[index][ngRoundCount-1] = [4]uint32{1, 2, 3, 4}
+
+	data := append(make([]byte, 32), "tail"...)
+	result := ng.decrypt(data, "launcher.rpf", 1000)
+
+	block := make([]byte, 16)
+	for i, value := range ng.Keys[index][ngRoundCount-1] {
+		binary.LittleEndian.PutUint32(block[i*4:], value)
+	}
+
+	if !bytes.Equal(result[:16], block) || !bytes.Equal(result[16:32], block) {
+		t.Errorf("blocks = %x, want %x twice", result[:32], block)
+	}
+
+	if string(result[32:]) != "tail" {
+		t.Errorf("trailing bytes = %q, want them as is", result[32:])
+	}
+}
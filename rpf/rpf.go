@@ -0,0 +1,1346 @@
+// Package rpf reads RAGE Packfiles (RPF0, RPF2, RPF3, RPF4 and RPF7)
+// and extracts their content
+package rpf
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Disquse/RGLExtractor/internal/iostream"
+)
+
+var (
+	ErrFileType     = errors.New("rpf: unsupported file type, expected RPF0, RPF2, RPF3, RPF4 or RPF7")
+	ErrEncryption   = errors.New("rpf: unsupported encryption type")
+	ErrNoCrypto     = errors.New("rpf: pack is encrypted, but no crypto is set")
+	ErrNoReader     = errors.New("rpf: reader is not initialized")
+	ErrNotReadable  = errors.New("rpf: file is not ready for reading")
+	ErrCantExtract  = errors.New("rpf: can not extract entry of this type")
+	ErrResourceSize = errors.New("rpf: resource entry is smaller than its header")
+	ErrNestedCycle  = errors.New("rpf: nested pack refers to one of its parents")
+	ErrNestedDepth  = errors.New("rpf: nested packs are too deep")
+
+	ErrEntryNotFound  = errors.New("rpf: entry not found")
+	ErrNameOffset     = errors.New("rpf: entry name offset is out of names range")
+	ErrNameTerminator = errors.New("rpf: entry name is not null-terminated")
+)
+
+const (
+	packMagic0 = 0x52504630 // 'RPF0'
+	packMagic2 = 0x52504632 // 'RPF2'
+	packMagic3 = 0x52504633 // 'RPF3'
+	packMagic4 = 0x52504634 // 'RPF4'
+	packMagic6 = 0x52504636 // 'RPF6'
+	packMagic7 = 0x52504637 // 'RPF7'
+)
+
+const packDirectoryOffset = 0xFFFFFE00
+
+const (
+	packEncryptionNone = 0x0
+	packEncryptionOpen = 0x4E45504F // 'OPEN'
+	packEncryptionAES  = 0xFFFFFF7
+	packEncryptionNG   = 0xFEFFFFF
+)
+
+const (
+	resourceMagic      = 0x37435352 // 'RSC7'
+	resourceHeaderSize = 16
+	resourceOversized  = 0xFFFFFF
+)
+
+const maxNestedDepth = 8
+
+// PackHeader is a header of a pack, legacy versions fill only a part of it
+type PackHeader struct {
+	Magic         uint32
+	EntryCount    uint32
+	NamesLength   uint32
+	NameShift     uint8
+	PlatformBit   byte
+	DecryptionTag uint32
+}
+
+// PackEntry is an entry of a pack TOC, entries of legacy versions are
+// converted to RPF7 layout
+type PackEntry struct {
+	NameOffset uint32
+	OnDiskSize uint32
+	Offset     uint32
+	Resource   bool
+
+	// Size (Binary)
+	// VirtualFlags (Resource)
+	// EntryIndex (Directory)
+	second uint32
+
+	// DecryptionTag (Binary)
+	// PhysicalFlags (Resource)
+	// EntryCount (Directory)
+	third uint32
+
+	// Position in the TOC
+	index int
+}
+
+// PackFile is an opened pack of any supported RPF version
+type PackFile struct {
+	Path    string
+	Source  io.ReaderAt
+	Size    int64
+	Header  *PackHeader
+	Entries []*PackEntry
+	Names   []byte
+	Crypto  *AESCrypto
+
+	// GTA V NG crypto, only needed for NG encrypted packs
+	NGCrypto *NGCrypto
+
+	// Pack containing this one, nil for packs on disk
+	Parent *PackFile
+
+	// Parser for the RPF version of this pack
+	parser packParser
+
+	// Sequential reader for header and TOC
+	reader *iostream.Reader
+
+	// Closes the underlying file, if the pack owns one
+	closer io.Closer
+
+	// Path of this pack inside the outermost pack, empty for packs on disk
+	entryPrefix string
+
+	// Outermost source this pack is stored in and its offset there,
+	// used to detect nested packs pointing back at their parents
+	base       io.ReaderAt
+	baseOffset int64
+}
+
+// Every RPF version has its own parser. Entries of older versions are
+// converted to RPF7 layout, so the rest of the code works with any of them
+type packParser interface {
+	readPackHeader(fi *PackFile) (*PackHeader, error)
+	readPackEntries(fi *PackFile) ([]*PackEntry, []byte, error)
+	readPackEntryContent(fi *PackFile, packEntry *PackEntry) ([]byte, error)
+	getEntryOffset(index int) int64
+}
+
+type rpf7Parser struct{}
+
+// ExtractOptions changes what Extract does, nil means defaults
+type ExtractOptions struct {
+	// Extract nested packs into directories named after their entries
+	Recursive bool
+
+	// Nesting limit for recursive extraction, maxNestedDepth if zero. Packs
+	// past it are extracted as files
+	MaxDepth int
+
+	// Only entries passing the filter are extracted, nil for all of them
+	Filter *EntryFilter
+
+	// Receives progress of extraction, may be nil
+	Observer Observer
+
+	// Keep extracting after a failed entry, Extract returns ExtractErrors
+	// with every failure at the end
+	KeepGoing bool
+}
+
+// ExtractError is a failure of a single entry during Extract
+type ExtractError struct {
+	// Path of the entry, prefixed with paths of parent packs
+	Path string
+	Err  error
+}
+
+func (e *ExtractError) Error() string {
+	return fmt.Sprintf("rpf: failed to extract \"%s\": %s", e.Path, e.Err)
+}
+
+func (e *ExtractError) Unwrap() error {
+	return e.Err
+}
+
+// ExtractErrors lists every entry that failed to extract with KeepGoing set
+type ExtractErrors []error
+
+func (e ExtractErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	return fmt.Sprintf("rpf: failed to extract %d entries", len(e))
+}
+
+// IsDirectory reports whether the entry is a directory
+func (fi *PackEntry) IsDirectory() bool {
+	return fi.Offset == packDirectoryOffset
+}
+
+// IsResource reports whether the entry is a resource
+func (fi *PackEntry) IsResource() bool {
+	return fi.Resource
+}
+
+// IsBinary reports whether the entry is a plain file
+func (fi *PackEntry) IsBinary() bool {
+	return !fi.IsResource() && !fi.IsDirectory()
+}
+
+// GetNameOffset returns offset of the name as stored, before NameShift
+func (fi *PackEntry) GetNameOffset() uint32 {
+	return fi.NameOffset
+}
+
+// GetIndex returns position of the entry in the TOC
+func (fi *PackEntry) GetIndex() int {
+	return fi.index
+}
+
+func (fi *PackFile) isReadable() bool {
+	if fi.Source == nil || fi.reader == nil || fi.Header == nil {
+		return false
+	}
+
+	return true
+}
+
+// Close closes the underlying file if the pack was opened by OpenPackFile
+func (fi *PackFile) Close() error {
+	if fi.closer == nil {
+		return nil
+	}
+
+	err := fi.closer.Close()
+	fi.closer = nil
+
+	return err
+}
+
+// ReadPackFile reads header and TOC of a pack stored in source. Entry
+// content is read from source on demand, so it has to stay available.
+// Crypto and ngCrypto may be nil when the pack doesn't need them
+func ReadPackFile(filePath string, source io.ReaderAt, size int64, crypto *AESCrypto, ngCrypto *NGCrypto) (*PackFile, error) {
+	packFile := &PackFile{
+		Path:     filePath,
+		Source:   source,
+		Size:     size,
+		reader:   iostream.NewReaderAt(source),
+		Crypto:   crypto,
+		NGCrypto: ngCrypto,
+		base:     source,
+	}
+
+	if err := packFile.readPack(); err != nil {
+		return nil, err
+	}
+
+	return packFile, nil
+}
+
+func (fi *PackFile) readPack() error {
+	magic, err := fi.readPackData(0, 4)
+	if err != nil {
+		return err
+	}
+
+	parser := getPackParser(magic)
+	if parser == nil {
+		return ErrFileType
+	}
+
+	fi.parser = parser
+
+	header, err := parser.readPackHeader(fi)
+	if err != nil {
+		return err
+	}
+
+	fi.Header = header
+
+	entries, names, err := parser.readPackEntries(fi)
+	if err != nil {
+		return err
+	}
+
+	for i, packEntry := range entries {
+		packEntry.index = i
+	}
+
+	fi.Entries = entries
+	fi.Names = names
+
+	if err := fi.validatePackEntries(); err != nil {
+		if fi.isTOCEncrypted() && isTOCError(err) {
+			return &KeyError{Err: err}
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Console packs are big endian, so the magic is checked in both orders
+func getPackParser(magic []byte) packParser {
+	if parser := newPackParser(binary.LittleEndian.Uint32(magic), binary.LittleEndian); parser != nil {
+		return parser
+	}
+
+	return newPackParser(binary.BigEndian.Uint32(magic), binary.BigEndian)
+}
+
+func newPackParser(magic uint32, order binary.ByteOrder) packParser {
+	switch magic {
+	case packMagic0, packMagic2:
+		return &legacyParser{order: order}
+	case packMagic3:
+		return &legacyParser{order: order, hashedNames: true}
+	case packMagic4:
+		return &legacyParser{order: order, hashedNames: true, offsetShift: 3}
+	case packMagic7:
+		if order == binary.LittleEndian {
+			return rpf7Parser{}
+		}
+	}
+
+	return nil
+}
+
+func (rpf7Parser) readPackHeader(fi *PackFile) (*PackHeader, error) {
+	return fi.readPackHeader()
+}
+
+func (rpf7Parser) readPackEntries(fi *PackFile) ([]*PackEntry, []byte, error) {
+	entries, err := fi.readPackEntries()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names, err := fi.readPackStrings()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entries, names, nil
+}
+
+func (rpf7Parser) readPackEntryContent(fi *PackFile, packEntry *PackEntry) ([]byte, error) {
+	if packEntry.IsResource() {
+		return fi.readResourceContent(packEntry)
+	}
+
+	return fi.readBinaryContent(packEntry)
+}
+
+func (rpf7Parser) getEntryOffset(index int) int64 {
+	return 16 + int64(index)*16
+}
+
+func (fi *PackFile) readPackHeader() (*PackHeader, error) {
+	if fi.reader == nil {
+		return nil, ErrNoReader
+	}
+
+	magic, err := fi.reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if magic != packMagic7 {
+		return nil, ErrFileType
+	}
+
+	entryCount, err := fi.reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	temp, err := fi.reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	decryptionTag, err := fi.reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	switch decryptionTag {
+	case packEncryptionNone, packEncryptionOpen, packEncryptionAES, packEncryptionNG:
+	default:
+		return nil, ErrEncryption
+	}
+
+	// Header, entries and names have to fit into the file
+	tocSize := 16 + uint64(entryCount)*16 + uint64(temp&0xFFFFFFF)
+	if tocSize > uint64(fi.Size) {
+		return nil, &PackError{Entry: -1, Offset: 16, Err: ErrTruncated}
+	}
+
+	packHeader := PackHeader{
+		Magic:         magic,
+		EntryCount:    entryCount,
+		NamesLength:   (temp & 0xFFFFFFF),        // 28 bits
+		NameShift:     uint8((temp >> 28) & 0x7), // 3 bits
+		PlatformBit:   byte(temp & 0x80000000),   // 1 bit
+		DecryptionTag: decryptionTag,
+	}
+
+	return &packHeader, nil
+}
+
+func (fi *PackFile) readPackEntry(reader *iostream.Reader) (*PackEntry, error) {
+	if !fi.isReadable() {
+		return nil, ErrNotReadable
+	}
+
+	first, err := reader.ReadUint64()
+	if err != nil {
+		return nil, err
+	}
+
+	second, err := reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	third, err := reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	packEntry := &PackEntry{
+		NameOffset: uint32(first & 0xFFFF),                  // 16 bits
+		OnDiskSize: uint32((first >> 16) & 0xFFFFFF),        // 24 bits
+		Offset:     uint32(((first >> 40) & 0x7FFFFF) << 9), // 23 bits
+		Resource:   (first >> 63) == 1,                      // 1 bit
+		second:     second,
+		third:      third,
+	}
+
+	return packEntry, nil
+}
+
+func (fi *PackFile) readPackEntries() ([]*PackEntry, error) {
+	if !fi.isReadable() {
+		return nil, ErrNotReadable
+	}
+
+	encrypted := make([]byte, fi.Header.EntryCount*16) // 16 bytes per entry
+
+	if _, err := fi.reader.Read(encrypted); err != nil {
+		return nil, err
+	}
+
+	decrypted, err := fi.decryptPackData(encrypted, fi.getPackName(), uint32(fi.Size))
+	if err != nil {
+		return nil, err
+	}
+
+	// Create temp reader
+	reader := iostream.NewReader(bytes.NewBuffer(decrypted))
+
+	entries := make([]*PackEntry, fi.Header.EntryCount)
+
+	for i := 0; i < int(fi.Header.EntryCount); i++ {
+		packEntry, err := fi.readPackEntry(reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		entries[i] = packEntry
+	}
+
+	return entries, nil
+}
+
+func (fi *PackFile) readPackStrings() ([]byte, error) {
+	if !fi.isReadable() {
+		return nil, ErrNotReadable
+	}
+
+	encrypted := make([]byte, fi.Header.NamesLength)
+
+	if _, err := fi.reader.Read(encrypted); err != nil {
+		return nil, err
+	}
+
+	return fi.decryptPackData(encrypted, fi.getPackName(), uint32(fi.Size))
+}
+
+// OpenPackFile opens a pack file on disk, it stays open until Close
+func OpenPackFile(filePath string, crypto *AESCrypto, ngCrypto *NGCrypto) (*PackFile, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Entries are read on demand, so the file stays open until Close
+	packFile, err := ReadPackFile(filePath, file, stat.Size(), crypto, ngCrypto)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	packFile.closer = file
+
+	return packFile, nil
+}
+
+// BuildEntryPathMap returns root relative paths of all entries but the
+// root itself, keyed by entry index
+func (fi *PackFile) BuildEntryPathMap() (map[int]string, error) {
+	if len(fi.Entries) == 0 {
+		return nil, ErrNoRootEntry
+	}
+
+	// Map for root relative paths of entries, root itself has empty path
+	pathsMap := make(map[int]string)
+	pathsMap[0] = ""
+
+	// Append root directory
+	entryStack := []int{0}
+
+	// Build root relative paths for entries
+	for {
+		if len(entryStack) <= 0 {
+			break
+		}
+
+		entryIndex := entryStack[len(entryStack)-1]
+		entryStack = entryStack[:len(entryStack)-1]
+
+		entryItem := fi.Entries[entryIndex]
+		entryPath := pathsMap[entryIndex]
+
+		startIndex := uint64(entryItem.GetDirectoryEntryIndex())
+		endIndex := startIndex + uint64(entryItem.GetDirectoryEntryCount())
+
+		if endIndex > uint64(len(fi.Entries)) {
+			return nil, fi.newEntryError(entryItem, ErrEntryRange)
+		}
+
+		for i := int(startIndex); i < int(endIndex); i++ {
+			innerPack := fi.Entries[i]
+
+			// Every entry belongs to exactly one directory, anything else
+			// means a cycle or a damaged TOC
+			if _, ok := pathsMap[i]; ok {
+				return nil, fi.newEntryError(innerPack, ErrDirectoryCycle)
+			}
+
+			innerName, err := fi.GetEntryName(innerPack)
+			if err != nil {
+				return nil, fi.newEntryError(innerPack, err)
+			}
+
+			if innerPack.IsDirectory() {
+				entryStack = append(entryStack, i)
+			}
+
+			if entryPath == "" {
+				pathsMap[i] = innerName
+			} else {
+				pathsMap[i] = path.Join(entryPath, innerName)
+			}
+		}
+	}
+
+	delete(pathsMap, 0)
+
+	return pathsMap, nil
+}
+
+// Extract writes every file and resource of the pack into outPath
+func (fi *PackFile) Extract(outPath string, options *ExtractOptions) error {
+	if !fi.isReadable() {
+		return ErrNotReadable
+	}
+
+	observer := options.getObserver()
+
+	entryPaths, err := fi.BuildEntryPathMap()
+	if err != nil {
+		// Nested pack fails as an entry of its parent
+		if fi.Parent != nil {
+			err = wrapExtractError(fi.entryPrefix, err)
+		}
+
+		observer.Error(&ErrorEvent{Path: fi.entryPrefix, Err: err})
+		return err
+	}
+
+	recursive := options != nil && options.Recursive
+
+	// Decide first, so the observer knows the amount of work beforehand
+	indices := make([]int, 0, len(entryPaths))
+	skipped := map[int]bool{}
+
+	openedEvent := &PackOpenedEvent{
+		Pack: fi,
+		Path: fi.entryPrefix,
+	}
+
+	for i, entryPath := range entryPaths {
+		packEntry := fi.Entries[i]
+
+		if packEntry == nil || packEntry.IsDirectory() {
+			continue
+		}
+
+		indices = append(indices, i)
+
+		// Nested packs are filtered by their content instead
+		if recursive && fi.isNestedPack(packEntry, entryPath) && !fi.isDepthLimited(options) {
+			continue
+		}
+
+		if options != nil && options.Filter != nil {
+			fullPath := path.Join(fi.entryPrefix, entryPath)
+
+			if !options.Filter.Match(fullPath, fi.getEntrySize(packEntry)) {
+				skipped[i] = true
+				continue
+			}
+		}
+
+		openedEvent.EntryCount++
+		openedEvent.TotalSize += fi.getEntrySize(packEntry)
+	}
+
+	sort.Ints(indices)
+
+	observer.PackOpened(openedEvent)
+
+	var failures ExtractErrors
+
+	for _, i := range indices {
+		packEntry := fi.Entries[i]
+		entryPath := entryPaths[i]
+		fullPath := path.Join(fi.entryPrefix, entryPath)
+
+		if skipped[i] {
+			observer.EntrySkipped(&EntrySkippedEvent{Path: fullPath, Reason: SkipReasonFilter})
+			continue
+		}
+
+		extractPath := path.Clean(path.Join(outPath, entryPath))
+
+		var err error
+		if recursive && fi.isNestedPack(packEntry, entryPath) && !fi.isDepthLimited(options) {
+			// Failures are reported by the nested pack
+			err = fi.extractNestedPack(packEntry, entryPath, fullPath, extractPath, options)
+		} else {
+			// Packs too deep to go into are written as they are
+			if recursive && fi.isNestedPack(packEntry, entryPath) {
+				observer.EntrySkipped(&EntrySkippedEvent{Path: fullPath, Reason: SkipReasonDepth})
+			}
+
+			err = fi.extractEntryWithEvents(packEntry, fullPath, extractPath, observer)
+
+			if err != nil {
+				err = wrapExtractError(fullPath, err)
+				observer.Error(&ErrorEvent{Path: fullPath, Err: err})
+			}
+		}
+
+		if err == nil {
+			continue
+		}
+
+		if nestedFailures, ok := err.(ExtractErrors); ok {
+			failures = append(failures, nestedFailures...)
+			continue
+		}
+
+		if options == nil || !options.KeepGoing {
+			return err
+		}
+
+		failures = append(failures, err)
+	}
+
+	if len(failures) > 0 {
+		return failures
+	}
+
+	return nil
+}
+
+// Adds the entry path to an error, unless a nested pack has done so
+func wrapExtractError(entryPath string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var extractErr *ExtractError
+	if errors.As(err, &extractErr) {
+		return err
+	}
+
+	if _, ok := err.(ExtractErrors); ok {
+		return err
+	}
+
+	return &ExtractError{Path: entryPath, Err: err}
+}
+
+func (fi *PackFile) isNestedPack(packEntry *PackEntry, entryPath string) bool {
+	return packEntry.IsBinary() && strings.HasSuffix(strings.ToLower(entryPath), ".rpf")
+}
+
+// Tells whether packs nested in this one are past the nesting limit
+func (fi *PackFile) isDepthLimited(options *ExtractOptions) bool {
+	maxDepth := options.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = maxNestedDepth
+	}
+
+	return fi.getNestedDepth() >= maxDepth
+}
+
+func (fi *PackFile) extractNestedPack(packEntry *PackEntry, entryPath string, fullPath string, outPath string, options *ExtractOptions) error {
+	nestedPack, err := fi.OpenNestedPack(packEntry, entryPath)
+	if err != nil {
+		err = wrapExtractError(fullPath, fi.newEntryError(packEntry, err))
+		options.getObserver().Error(&ErrorEvent{Path: fullPath, Err: err})
+
+		return err
+	}
+
+	return wrapExtractError(fullPath, nestedPack.Extract(outPath, options))
+}
+
+// OpenNestedPack opens a pack stored as an entry of this pack with the same
+// crypto. Stored packs are read in place, others are unpacked into memory first
+func (fi *PackFile) OpenNestedPack(packEntry *PackEntry, entryPath string) (*PackFile, error) {
+	if !fi.isReadable() {
+		return nil, ErrNotReadable
+	}
+
+	var source io.ReaderAt
+	var size int64
+
+	base := fi.base
+	baseOffset := fi.baseOffset + int64(packEntry.Offset)
+
+	if packEntry.OnDiskSize == 0 && packEntry.GetBinaryDecryptionTag() == 0 {
+		size = int64(packEntry.GetBinarySize())
+		source = io.NewSectionReader(fi.Source, int64(packEntry.Offset), size)
+	} else {
+		content, err := fi.ReadEntryContent(packEntry)
+		if err != nil {
+			return nil, err
+		}
+
+		reader := bytes.NewReader(content)
+
+		size = int64(len(content))
+		source = reader
+		base = reader
+		baseOffset = 0
+	}
+
+	for parent := fi; parent != nil; parent = parent.Parent {
+		if parent.base == base && parent.baseOffset == baseOffset && parent.Size == size {
+			return nil, ErrNestedCycle
+		}
+	}
+
+	nestedPack := &PackFile{
+		Path:        path.Join(fi.Path, entryPath),
+		Source:      source,
+		Size:        size,
+		reader:      iostream.NewReaderAt(source),
+		Crypto:      fi.Crypto,
+		NGCrypto:    fi.NGCrypto,
+		Parent:      fi,
+		entryPrefix: path.Join(fi.entryPrefix, entryPath),
+		base:        base,
+		baseOffset:  baseOffset,
+	}
+
+	if err := nestedPack.readPack(); err != nil {
+		return nil, err
+	}
+
+	return nestedPack, nil
+}
+
+func (fi *PackFile) getNestedDepth() int {
+	depth := 0
+
+	for parent := fi.Parent; parent != nil; parent = parent.Parent {
+		depth++
+	}
+
+	return depth
+}
+
+func (fi *PackFile) extractEntryWithEvents(packEntry *PackEntry, fullPath string, outPath string, observer Observer) error {
+	entryType := EntryTypeBinary
+	if packEntry.IsResource() {
+		entryType = EntryTypeResource
+	}
+
+	entrySize := fi.getEntrySize(packEntry)
+
+	observer.EntryStarted(&EntryStartedEvent{
+		Path: fullPath,
+		Type: entryType,
+		Size: entrySize,
+	})
+
+	doneEvent := &EntryDoneEvent{
+		Path:       fullPath,
+		Type:       entryType,
+		Size:       entrySize,
+		OnDiskSize: int64(packEntry.GetStoredSize()),
+	}
+
+	startTime := time.Now()
+
+	var entryContent []byte
+	doneEvent.OutPath, entryContent, doneEvent.Err = fi.extractEntry(packEntry, outPath, true)
+	doneEvent.ContentType = DetectContentType(entryContent)
+	doneEvent.Duration = time.Since(startTime)
+
+	if doneEvent.Err == nil {
+		doneEvent.Written = int64(len(entryContent))
+	}
+
+	observer.EntryDone(doneEvent)
+
+	return doneEvent.Err
+}
+
+// ExtractEntry writes content of a single entry into outPath as it is,
+// unlike Extract it doesn't guess a missing extension
+func (fi *PackFile) ExtractEntry(packEntry *PackEntry, outPath string) error {
+	_, _, err := fi.extractEntry(packEntry, outPath, false)
+	return err
+}
+
+// Returns the path actually written along with the content. Extension is
+// guessed from content when guessExtension is set and outPath has none
+func (fi *PackFile) extractEntry(packEntry *PackEntry, outPath string, guessExtension bool) (string, []byte, error) {
+	if !fi.isReadable() {
+		return outPath, nil, ErrNotReadable
+	}
+
+	if packEntry.IsDirectory() {
+		return outPath, nil, ErrCantExtract
+	}
+
+	entryContent, err := fi.ReadEntryContent(packEntry)
+	if err != nil {
+		return outPath, nil, err
+	}
+
+	// Some entries has no extension, let's guess using magic
+	if guessExtension && filepath.Ext(outPath) == "" {
+		outPath += getContentExtension(entryContent)
+	}
+
+	directory, _ := filepath.Split(outPath)
+
+	if _, err := os.Stat(directory); directory != "" && os.IsNotExist(err) {
+		err := os.MkdirAll(directory, 0755)
+
+		if err != nil {
+			return outPath, entryContent, err
+		}
+	}
+
+	file, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return outPath, entryContent, err
+	}
+
+	defer file.Close()
+
+	if _, err = file.Write(entryContent); err != nil {
+		return outPath, entryContent, err
+	}
+
+	return outPath, entryContent, nil
+}
+
+// ReadEntryContent returns decrypted and decompressed content of a file,
+// or a complete RSC7 file for a resource
+func (fi *PackFile) ReadEntryContent(packEntry *PackEntry) ([]byte, error) {
+	if fi.parser == nil {
+		return nil, ErrNotReadable
+	}
+
+	if packEntry.IsDirectory() {
+		return nil, ErrCantExtract
+	}
+
+	content, err := fi.parser.readPackEntryContent(fi, packEntry)
+	if err != nil {
+		return nil, fi.newEntryError(packEntry, err)
+	}
+
+	return content, nil
+}
+
+// Uncompressed size of a file or a resource, as far as it is known
+func (fi *PackFile) getEntrySize(packEntry *PackEntry) int64 {
+	if packEntry.IsDirectory() {
+		return 0
+	}
+
+	if !packEntry.IsResource() {
+		return int64(packEntry.GetBinarySize())
+	}
+
+	// Only RPF7 resource flags describe page sizes
+	if fi.Header.Magic == packMagic7 {
+		return int64(packEntry.GetResourceSize())
+	}
+
+	return int64(packEntry.GetStoredSize())
+}
+
+// Only scripts are encrypted among resources
+func isEncryptedResource(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".ysc")
+}
+
+func getContentExtension(content []byte) string {
+	switch contentType := DetectContentType(content); contentType {
+	case "jpg", "png", "gif":
+		return "." + contentType
+	}
+
+	return ".bin"
+}
+
+// DetectContentType guesses type of entry content by its magic, "bin" if
+// nothing matches
+func DetectContentType(content []byte) string {
+	if len(content) >= 10 && string(content[6:10]) == "Exif" {
+		return "jpg"
+	} else if len(content) >= 4 && string(content[1:4]) == "PNG" {
+		return "png"
+	} else if len(content) >= 3 && string(content[0:3]) == "GIF" {
+		return "gif"
+	} else if len(content) >= 4 && binary.LittleEndian.Uint32(content) == resourceMagic {
+		return "rsc"
+	} else if len(content) >= 4 && string(content[0:3]) == "RPF" {
+		return "rpf"
+	}
+
+	trimmed := bytes.TrimLeft(content, " \t\r\n\xEF\xBB\xBF")
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return "json"
+	} else if len(trimmed) > 0 && trimmed[0] == '<' {
+		return "xml"
+	}
+
+	return "bin"
+}
+
+func (fi *PackFile) readBinaryContent(packEntry *PackEntry) ([]byte, error) {
+	entrySize := int(packEntry.OnDiskSize)
+	binarySize := packEntry.GetBinarySize()
+
+	if entrySize == 0 {
+		entrySize = binarySize
+	}
+
+	entryContent, err := fi.readPackData(int64(packEntry.Offset), entrySize)
+	if err != nil {
+		return nil, err
+	}
+
+	if packEntry.GetBinaryDecryptionTag() == 1 {
+		entryName, err := fi.GetEntryName(packEntry)
+		if err != nil {
+			return nil, err
+		}
+
+		entryContent, err = fi.decryptPackData(entryContent, entryName, uint32(binarySize))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Entry is compressed
+	if packEntry.OnDiskSize > 0 {
+		if err := packEntry.validateCompressedSize(binarySize); err != nil {
+			return nil, err
+		}
+
+		reader := flate.NewReader(bytes.NewReader(entryContent))
+		decompressed := make([]byte, binarySize)
+
+		defer reader.Close()
+
+		if _, err := io.ReadFull(reader, decompressed); err != nil {
+			return nil, err
+		}
+
+		entryContent = decompressed
+	}
+
+	return entryContent, nil
+}
+
+// Resources are stored with their RSC7 header in front, the content stays
+// compressed and is written out as a standalone RSC7 file
+func (fi *PackFile) readResourceContent(packEntry *PackEntry) ([]byte, error) {
+	entryOffset := int64(packEntry.Offset)
+	entrySize := int(packEntry.OnDiskSize)
+
+	// Real size of oversized resources is scattered over the stored header
+	if packEntry.OnDiskSize == resourceOversized {
+		header, err := fi.readPackData(entryOffset, resourceHeaderSize)
+		if err != nil {
+			return nil, err
+		}
+
+		entrySize = int(header[7]) | int(header[14])<<8 | int(header[5])<<16 | int(header[2])<<24
+	}
+
+	if entrySize < resourceHeaderSize {
+		return nil, ErrResourceSize
+	}
+
+	entryContent, err := fi.readPackData(entryOffset+resourceHeaderSize, entrySize-resourceHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+
+	entryName, err := fi.GetEntryName(packEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	if isEncryptedResource(entryName) {
+		entryContent, err = fi.decryptPackData(entryContent, entryName, uint32(entrySize))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	virtualFlags := packEntry.GetResourceVirtualFlags()
+	physicalFlags := packEntry.GetResourcePhysicalFlags()
+
+	header := make([]byte, resourceHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], resourceMagic)
+	binary.LittleEndian.PutUint32(header[4:], packEntry.GetResourceVersion())
+	binary.LittleEndian.PutUint32(header[8:], virtualFlags)
+	binary.LittleEndian.PutUint32(header[12:], physicalFlags)
+
+	return append(header, entryContent...), nil
+}
+
+// Decrypts TOC, names or entry data using the scheme from the header tag.
+// NG derives its key from the name and size of the pack or entry
+func (fi *PackFile) decryptPackData(data []byte, name string, length uint32) ([]byte, error) {
+	switch fi.Header.DecryptionTag {
+	case packEncryptionNone, packEncryptionOpen:
+		return data, nil
+	case packEncryptionAES:
+		if fi.Crypto == nil {
+			return nil, ErrNoCrypto
+		}
+
+		return fi.Crypto.decrypt(data), nil
+	case packEncryptionNG:
+		if fi.NGCrypto == nil {
+			return nil, ErrNoCrypto
+		}
+
+		return fi.NGCrypto.decrypt(data, name, length), nil
+	}
+
+	return nil, ErrEncryption
+}
+
+func (fi *PackFile) readPackData(offset int64, size int) ([]byte, error) {
+	// Check before allocating, sizes may come from a damaged TOC
+	if offset < 0 || size < 0 || offset+int64(size) > fi.Size {
+		return nil, &PackError{Entry: -1, Offset: offset, Err: ErrTruncated}
+	}
+
+	data := make([]byte, size)
+
+	section := io.NewSectionReader(fi.Source, offset, int64(size))
+	if _, err := io.ReadFull(section, data); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (fi *PackFile) getPackName() string {
+	return filepath.Base(fi.Path)
+}
+
+// FindEntry looks up an entry by its root relative path, like
+// "titles/gta5/title.rgl". Names are compared case-insensitively
+func (fi *PackFile) FindEntry(entryPath string) (*PackEntry, error) {
+	if !fi.isReadable() || len(fi.Entries) == 0 {
+		return nil, ErrNotReadable
+	}
+
+	entryPath = strings.Trim(strings.ReplaceAll(entryPath, "\\", "/"), "/")
+	if entryPath == "" {
+		return nil, ErrEntryNotFound
+	}
+
+	current := fi.Entries[0]
+
+	for _, name := range strings.Split(entryPath, "/") {
+		if !current.IsDirectory() {
+			return nil, ErrEntryNotFound
+		}
+
+		var found *PackEntry
+
+		startIndex := current.GetDirectoryEntryIndex()
+		endIndex := startIndex + current.GetDirectoryEntryCount()
+
+		for i := startIndex; i < endIndex; i++ {
+			innerName, err := fi.GetEntryName(fi.Entries[i])
+			if err != nil {
+				return nil, fi.newEntryError(fi.Entries[i], err)
+			}
+
+			if strings.EqualFold(innerName, name) {
+				found = fi.Entries[i]
+				break
+			}
+		}
+
+		if found == nil {
+			return nil, ErrEntryNotFound
+		}
+
+		current = found
+	}
+
+	return current, nil
+}
+
+// FindNestedEntry is FindEntry that also looks inside nested packs, with
+// paths like "dir/inner.rpf/file.json" that Extract writes when recursive.
+// The pack the entry was found in is returned along with it
+func (fi *PackFile) FindNestedEntry(entryPath string) (*PackFile, *PackEntry, error) {
+	packEntry, err := fi.FindEntry(entryPath)
+	if err != ErrEntryNotFound {
+		return fi, packEntry, err
+	}
+
+	names := strings.Split(strings.Trim(strings.ReplaceAll(entryPath, "\\", "/"), "/"), "/")
+
+	// The longest prefix that is a pack goes first
+	for i := len(names) - 1; i > 0; i-- {
+		packPath := strings.Join(names[:i], "/")
+
+		nestedEntry, err := fi.FindEntry(packPath)
+		if err != nil || !fi.isNestedPack(nestedEntry, packPath) {
+			continue
+		}
+
+		nestedPack, err := fi.OpenNestedPack(nestedEntry, packPath)
+		if err != nil {
+			return nil, nil, fi.newEntryError(nestedEntry, err)
+		}
+
+		return nestedPack.FindNestedEntry(strings.Join(names[i:], "/"))
+	}
+
+	return nil, nil, ErrEntryNotFound
+}
+
+// WriteEntry writes content of a single entry into writer, same content
+// as ExtractEntry would write into a file
+func (fi *PackFile) WriteEntry(packEntry *PackEntry, writer io.Writer) error {
+	entryContent, err := fi.ReadEntryContent(packEntry)
+	if err != nil {
+		return err
+	}
+
+	_, err = writer.Write(entryContent)
+	return err
+}
+
+// GetEntryName returns the name of the entry without its directory
+func (fi *PackFile) GetEntryName(packEntry *PackEntry) (string, error) {
+	// Name offsets are stored in units of 1 << NameShift bytes
+	startPos := uint64(packEntry.GetNameOffset()) << fi.Header.NameShift
+
+	namesLength := uint64(fi.Header.NamesLength)
+	if namesLength > uint64(len(fi.Names)) {
+		namesLength = uint64(len(fi.Names))
+	}
+
+	if startPos >= namesLength {
+		return "", ErrNameOffset
+	}
+
+	// Find string with null terminator, better than initializing reader
+	length := bytes.IndexByte(fi.Names[startPos:namesLength], 0x0)
+	if length < 0 {
+		return "", ErrNameTerminator
+	}
+
+	return string(fi.Names[startPos : startPos+uint64(length)]), nil
+}
+
+// GetDirectoryEntryIndex returns index of the first child of a directory
+func (fi *PackEntry) GetDirectoryEntryIndex() int {
+	if !fi.IsDirectory() {
+		return 0
+	}
+
+	return int(fi.second)
+}
+
+// GetDirectoryEntryCount returns number of children of a directory
+func (fi *PackEntry) GetDirectoryEntryCount() int {
+	if !fi.IsDirectory() {
+		return 0
+	}
+
+	return int(fi.third)
+}
+
+// GetBinarySize returns uncompressed size of a file
+func (fi *PackEntry) GetBinarySize() int {
+	if !fi.IsBinary() {
+		return 0
+	}
+
+	return int(fi.second)
+}
+
+// GetBinaryDecryptionTag returns 1 for encrypted files
+func (fi *PackEntry) GetBinaryDecryptionTag() int {
+	if !fi.IsBinary() {
+		return 0
+	}
+
+	return int(fi.third)
+}
+
+// GetResourceVirtualFlags returns virtual (system) flags of a resource
+func (fi *PackEntry) GetResourceVirtualFlags() uint32 {
+	if !fi.IsResource() {
+		return 0
+	}
+
+	return fi.second
+}
+
+// GetResourcePhysicalFlags returns physical (graphics) flags of a resource
+func (fi *PackEntry) GetResourcePhysicalFlags() uint32 {
+	if !fi.IsResource() {
+		return 0
+	}
+
+	return fi.third
+}
+
+// GetResourceVersion returns version of a resource, it is split between
+// the top 4 bits of both flags
+func (fi *PackEntry) GetResourceVersion() uint32 {
+	virtualVersion := (fi.GetResourceVirtualFlags() >> 28) & 0xF
+	physicalVersion := (fi.GetResourcePhysicalFlags() >> 28) & 0xF
+
+	return virtualVersion<<4 | physicalVersion
+}
+
+// GetStoredSize returns size of entry data in the pack file, oversized
+// resources only guarantee their header
+func (fi *PackEntry) GetStoredSize() uint32 {
+	if fi.IsDirectory() {
+		return 0
+	}
+
+	if fi.IsResource() && fi.OnDiskSize == resourceOversized {
+		return resourceHeaderSize
+	}
+
+	if fi.OnDiskSize > 0 {
+		return fi.OnDiskSize
+	}
+
+	return fi.second
+}
+
+// GetResourceSize returns size of virtual and physical pages of an RPF7
+// resource, that is its size after decompression
+func (fi *PackEntry) GetResourceSize() uint32 {
+	return getResourcePagesSize(fi.GetResourceVirtualFlags()) + getResourcePagesSize(fi.GetResourcePhysicalFlags())
+}
+
+// Flags store page counts for 9 page sizes, based on the lowest 4 bits
+func getResourcePagesSize(flags uint32) uint32 {
+	baseSize := uint32(0x200) << (flags & 0xF)
+
+	pages := ((flags >> 27) & 0x1) << 0
+	pages += ((flags >> 26) & 0x1) << 1
+	pages += ((flags >> 25) & 0x1) << 2
+	pages += ((flags >> 24) & 0x1) << 3
+	pages += ((flags >> 17) & 0x7F) << 4
+	pages += ((flags >> 11) & 0x3F) << 5
+	pages += ((flags >> 7) & 0xF) << 6
+	pages += ((flags >> 5) & 0x3) << 7
+	pages += ((flags >> 4) & 0x1) << 8
+
+	return baseSize * pages
+}
+
+// GetVersion returns RPF version number from the magic
+func (ph *PackHeader) GetVersion() int {
+	return int(ph.Magic&0xFF) - '0'
+}
+
+// GetEncryptionName returns a short name of the TOC encryption
+func (ph *PackHeader) GetEncryptionName() string {
+	if ph.Magic != packMagic7 {
+		if ph.DecryptionTag == 0 {
+			return "none"
+		}
+
+		return "aes"
+	}
+
+	switch ph.DecryptionTag {
+	case packEncryptionNone:
+		return "none"
+	case packEncryptionOpen:
+		return "open"
+	case packEncryptionAES:
+		return "aes"
+	case packEncryptionNG:
+		return "ng"
+	}
+
+	return "unknown"
+}
@@ -0,0 +1,306 @@
+package rpf
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testFile struct {
+	name    string
+	content []byte
+
+	// Resources keep their stored header in content
+	resource      bool
+	virtualFlags  uint32
+	physicalFlags uint32
+}
+
+// Builds an RPF7 pack with a root directory holding files. TOC is AES
+// encrypted with key, unless it's nil
+func makeRPF7Pack(files []testFile, key []byte) []byte {
+	return makeShiftedRPF7Pack(files, key, 0)
+}
+
+// Same as makeRPF7Pack with names aligned to 1 << nameShift bytes, name
+// offsets are stored in these units
+func makeShiftedRPF7Pack(files []testFile, key []byte, nameShift uint) []byte {
+	names := []byte{0}
+	nameOffsets := make([]int, len(files))
+
+	for i, file := range files {
+		for len(names)%(1<<nameShift) != 0 {
+			names = append(names, 0)
+		}
+
+		nameOffsets[i] = len(names) >> nameShift
+		names = append(names, file.name...)
+		names = append(names, 0)
+	}
+
+	for len(names)%16 != 0 {
+		names = append(names, 0)
+	}
+
+	entryCount := 1 + len(files)
+	toc := make([]byte, entryCount*16)
+
+	// Root directory
+	binary.LittleEndian.PutUint64(toc[0:], 0x7FFFFF<<40)
+	binary.LittleEndian.PutUint32(toc[8:], 1)
+	binary.LittleEndian.PutUint32(toc[12:], uint32(len(files)))
+
+	var data []byte
+	dataOffset := alignTestOffset(16 + len(toc) + len(names))
+
+	for i, file := range files {
+		offset := dataOffset + len(data)
+		entry := toc[(i+1)*16:]
+
+		first := uint64(nameOffsets[i]) | uint64(offset>>9)<<40
+
+		if file.resource {
+			onDiskSize := len(file.content)
+			if onDiskSize > resourceOversized {
+				onDiskSize = resourceOversized
+			}
+
+			first |= uint64(onDiskSize)<<16 | 1<<63
+
+			binary.LittleEndian.PutUint32(entry[8:], file.virtualFlags)
+			binary.LittleEndian.PutUint32(entry[12:], file.physicalFlags)
+		} else {
+			binary.LittleEndian.PutUint32(entry[8:], uint32(len(file.content)))
+		}
+
+		binary.LittleEndian.PutUint64(entry[0:], first)
+
+		data = append(data, file.content...)
+		data = append(data, make([]byte, alignTestOffset(len(data))-len(data))...)
+	}
+
+	toc = append(toc, names...)
+
+	decryptionTag := uint32(packEncryptionNone)
+
+	if key != nil {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			panic(err)
+		}
+
+		for i := 0; i < len(toc); i += aes.BlockSize {
+			block.Encrypt(toc[i:], toc[i:])
+		}
+
+		decryptionTag = packEncryptionAES
+	}
+
+	header := make([]byte, 16)
+	binary.LittleEndian.PutUint32(header[0:], packMagic7)
+	binary.LittleEndian.PutUint32(header[4:], uint32(entryCount))
+	binary.LittleEndian.PutUint32(header[8:], uint32(len(names))|uint32(nameShift)<<28)
+	binary.LittleEndian.PutUint32(header[12:], decryptionTag)
+
+	pack := make([]byte, dataOffset)
+	copy(pack, header)
+	copy(pack[16:], toc)
+
+	return append(pack, data...)
+}
+
+func alignTestOffset(offset int) int {
+	return (offset + 511) &^ 511
+}
+
+type testObserver struct {
+	BaseObserver
+	skipped []*EntrySkippedEvent
+	errors  []*ErrorEvent
+}
+
+func (to *testObserver) EntrySkipped(event *EntrySkippedEvent) {
+	to.skipped = append(to.skipped, event)
+}
+
+func (to *testObserver) Error(event *ErrorEvent) {
+	to.errors = append(to.errors, event)
+}
+
+func TestExtractMaxDepth(t *testing.T) {
+	inner := makeRPF7Pack([]testFile{{name: "a.txt", content: []byte("hello")}}, nil)
+	middle := makeRPF7Pack([]testFile{{name: "inner.rpf", content: inner}}, nil)
+	outer := makeRPF7Pack([]testFile{{name: "middle.rpf", content: middle}}, nil)
+
+	packFile, err := ReadPackFile("outer.rpf", bytes.NewReader(outer), int64(len(outer)), nil, nil)
+	if err != nil {
+		t.Fatalf("ReadPackFile: %v", err)
+	}
+
+	outPath := t.TempDir()
+	observer := &testObserver{}
+
+	err = packFile.Extract(outPath, &ExtractOptions{Recursive: true, MaxDepth: 1, Observer: observer})
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outPath, "middle.rpf", "inner.rpf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(content, inner) {
+		t.Error("pack past MaxDepth is not written as it is")
+	}
+
+	if len(observer.skipped) != 1 || observer.skipped[0].Path != "middle.rpf/inner.rpf" || observer.skipped[0].Reason != SkipReasonDepth {
+		t.Errorf("skipped = %v, want middle.rpf/inner.rpf for depth", observer.skipped)
+	}
+}
+
+func TestExtractErrorEvents(t *testing.T) {
+	pack := makeRPF7Pack([]testFile{
+		{name: "bad.rpf", content: []byte("not a pack")},
+		{name: "good.txt", content: []byte("hello")},
+	}, nil)
+
+	packFile, err := ReadPackFile("test.rpf", bytes.NewReader(pack), int64(len(pack)), nil, nil)
+	if err != nil {
+		t.Fatalf("ReadPackFile: %v", err)
+	}
+
+	observer := &testObserver{}
+
+	err = packFile.Extract(t.TempDir(), &ExtractOptions{Recursive: true, KeepGoing: true, Observer: observer})
+
+	failures, ok := err.(ExtractErrors)
+	if !ok || len(failures) != 1 {
+		t.Fatalf("Extract = %v, want a single failure", err)
+	}
+
+	if len(observer.errors) != 1 || observer.errors[0].Path != "bad.rpf" || observer.errors[0].Err != failures[0] {
+		t.Errorf("errors = %v, want the failure of bad.rpf", observer.errors)
+	}
+}
+
+func TestExtractEntryPath(t *testing.T) {
+	content := []byte("{\"a\":1}")
+	pack := makeRPF7Pack([]testFile{{name: "noext", content: content}}, nil)
+
+	packFile, err := ReadPackFile("test.rpf", bytes.NewReader(pack), int64(len(pack)), nil, nil)
+	if err != nil {
+		t.Fatalf("ReadPackFile: %v", err)
+	}
+
+	packEntry, err := packFile.FindEntry("noext")
+	if err != nil {
+		t.Fatalf("FindEntry: %v", err)
+	}
+
+	// Path given for a single entry is used as it is
+	outPath := filepath.Join(t.TempDir(), "outfile")
+
+	if err := packFile.ExtractEntry(packEntry, outPath); err != nil {
+		t.Fatalf("ExtractEntry: %v", err)
+	}
+
+	written, err := os.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(written, content) {
+		t.Errorf("content = %q, want %q", written, content)
+	}
+}
+
+func makeTestResource(size int) []byte {
+	content := make([]byte, size)
+	for i := resourceHeaderSize; i < size; i++ {
+		content[i] = byte(i)
+	}
+
+	return content
+}
+
+func readTestResource(t *testing.T, file testFile) []byte {
+	t.Helper()
+
+	pack := makeRPF7Pack([]testFile{file}, nil)
+
+	packFile, err := ReadPackFile("test.rpf", bytes.NewReader(pack), int64(len(pack)), nil, nil)
+	if err != nil {
+		t.Fatalf("ReadPackFile: %v", err)
+	}
+
+	content, err := packFile.ReadEntryContent(packFile.Entries[1])
+	if err != nil {
+		t.Fatalf("ReadEntryContent: %v", err)
+	}
+
+	return content
+}
+
+func TestResourceHeader(t *testing.T) {
+	stored := makeTestResource(100)
+
+	content := readTestResource(t, testFile{
+		name:          "model.ydr",
+		content:       stored,
+		resource:      true,
+		virtualFlags:  0x20000012,
+		physicalFlags: 0x50000034,
+	})
+
+	header := content[:resourceHeaderSize]
+
+	if magic := binary.LittleEndian.Uint32(header[0:]); magic != resourceMagic {
+		t.Errorf("magic = 0x%08X, want 0x%08X", magic, resourceMagic)
+	}
+
+	if version := binary.LittleEndian.Uint32(header[4:]); version != 0x25 {
+		t.Errorf("version = 0x%X, want 0x25", version)
+	}
+
+	if flags := binary.LittleEndian.Uint32(header[8:]); flags != 0x20000012 {
+		t.Errorf("virtual flags = 0x%08X, want 0x20000012", flags)
+	}
+
+	if flags := binary.LittleEndian.Uint32(header[12:]); flags != 0x50000034 {
+		t.Errorf("physical flags = 0x%08X, want 0x50000034", flags)
+	}
+
+	// Stored header is replaced, the rest is kept
+	if !bytes.Equal(content[resourceHeaderSize:], stored[resourceHeaderSize:]) {
+		t.Error("resource data is changed")
+	}
+}
+
+func TestOversizedResource(t *testing.T) {
+	size := resourceOversized + 0x1234
+	stored := makeTestResource(size)
+
+	// Real size is scattered over the stored header
+	stored[2] = byte(size >> 24)
+	stored[5] = byte(size >> 16)
+	stored[14] = byte(size >> 8)
+	stored[7] = byte(size)
+
+	content := readTestResource(t, testFile{
+		name:     "big.ytd",
+		content:  stored,
+		resource: true,
+	})
+
+	if len(content) != size {
+		t.Fatalf("size = %d, want %d", len(content), size)
+	}
+
+	if !bytes.Equal(content[resourceHeaderSize:], stored[resourceHeaderSize:]) {
+		t.Error("resource data is changed")
+	}
+}
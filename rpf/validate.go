@@ -0,0 +1,183 @@
+package rpf
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTruncated      = errors.New("rpf: pack is truncated")
+	ErrNoRootEntry    = errors.New("rpf: root entry is not a directory")
+	ErrEntryRange     = errors.New("rpf: directory entry range is out of bounds")
+	ErrDataRange      = errors.New("rpf: entry data is out of file bounds")
+	ErrDirectoryCycle = errors.New("rpf: entry is referenced by more than one directory")
+	ErrEntrySize      = errors.New("rpf: entry size does not match its compressed size")
+	ErrEntryName      = errors.New("rpf: entry name is empty or not printable")
+	ErrWrongKey       = errors.New("rpf: decrypted TOC makes no sense, the key is wrong")
+)
+
+// Deflate can't compress better than that, so bigger sizes are bogus
+const maxDeflateRatio = 1032
+
+// PackError describes a structural problem found in a pack. Entry is -1 when the
+// problem is not related to a single entry, Offset points into the pack file
+type PackError struct {
+	Entry  int
+	Offset int64
+	Err    error
+}
+
+func (e *PackError) Error() string {
+	if e.Entry < 0 {
+		return fmt.Sprintf("%s (offset 0x%X)", e.Err, e.Offset)
+	}
+
+	return fmt.Sprintf("%s (entry %d, offset 0x%X)", e.Err, e.Entry, e.Offset)
+}
+
+func (e *PackError) Unwrap() error {
+	return e.Err
+}
+
+// KeyError is returned when a TOC fails validation after decryption, which
+// means the key is wrong rather than the pack is damaged. It matches
+// ErrWrongKey with errors.Is, Err is the problem found in the TOC
+type KeyError struct {
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrWrongKey, e.Err)
+}
+
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+func (e *KeyError) Is(target error) bool {
+	return target == ErrWrongKey
+}
+
+// Wraps an error with position of the entry, unless it already has one
+func (fi *PackFile) newEntryError(packEntry *PackEntry, err error) error {
+	var packErr *PackError
+	if errors.As(err, &packErr) && packErr.Entry >= 0 {
+		return err
+	}
+
+	offset := int64(packEntry.Offset)
+	if packEntry.IsDirectory() {
+		offset = fi.parser.getEntryOffset(packEntry.index)
+	}
+
+	return &PackError{
+		Entry:  packEntry.index,
+		Offset: offset,
+		Err:    err,
+	}
+}
+
+// Checks every entry against the pack, so later reads can rely on them
+func (fi *PackFile) validatePackEntries() error {
+	entryCount := uint64(len(fi.Entries))
+
+	if entryCount == 0 || !fi.Entries[0].IsDirectory() {
+		return &PackError{Entry: 0, Offset: fi.parser.getEntryOffset(0), Err: ErrNoRootEntry}
+	}
+
+	// The whole TOC goes first, so a wrong key is told apart from a
+	// truncated file by the first error found
+	for _, packEntry := range fi.Entries {
+		if err := fi.validateEntryName(packEntry); err != nil {
+			return fi.newEntryError(packEntry, err)
+		}
+
+		if !packEntry.IsDirectory() {
+			continue
+		}
+
+		startIndex := uint64(packEntry.GetDirectoryEntryIndex())
+		endIndex := startIndex + uint64(packEntry.GetDirectoryEntryCount())
+
+		if endIndex > entryCount {
+			return fi.newEntryError(packEntry, ErrEntryRange)
+		}
+	}
+
+	for _, packEntry := range fi.Entries {
+		if packEntry.IsDirectory() {
+			continue
+		}
+
+		if uint64(packEntry.Offset)+uint64(packEntry.GetStoredSize()) > uint64(fi.Size) {
+			return fi.newEntryError(packEntry, ErrDataRange)
+		}
+	}
+
+	return nil
+}
+
+// Names have to be null-terminated and in bounds. Encrypted ones are also
+// checked to be ASCII, only the root entry has none, so a wrong key shows.
+// Plain packs may have names in other encodings
+func (fi *PackFile) validateEntryName(packEntry *PackEntry) error {
+	name, err := fi.GetEntryName(packEntry)
+	if err != nil || !fi.isTOCEncrypted() {
+		return err
+	}
+
+	if name == "" && packEntry.index != 0 {
+		return ErrEntryName
+	}
+
+	for i := 0; i < len(name); i++ {
+		if name[i] < 0x20 || name[i] >= 0x7F {
+			return ErrEntryName
+		}
+	}
+
+	return nil
+}
+
+// Problems found inside the TOC alone. In an encrypted TOC they come from
+// a wrong key, while data out of file bounds means a damaged file
+var tocErrors = []error{
+	ErrNoRootEntry,
+	ErrEntryRange,
+	ErrEntryName,
+	ErrNameOffset,
+	ErrNameTerminator,
+	ErrDirectoryCycle,
+}
+
+func isTOCError(err error) bool {
+	for _, target := range tocErrors {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (fi *PackFile) isTOCEncrypted() bool {
+	// Legacy packs only tell whether they are encrypted
+	if fi.Header.Magic != packMagic7 {
+		return fi.Header.DecryptionTag != 0
+	}
+
+	switch fi.Header.DecryptionTag {
+	case packEncryptionAES, packEncryptionNG:
+		return true
+	}
+
+	return false
+}
+
+func (fi *PackEntry) validateCompressedSize(size int) error {
+	if uint64(size) > uint64(fi.OnDiskSize)*maxDeflateRatio {
+		return ErrEntrySize
+	}
+
+	return nil
+}
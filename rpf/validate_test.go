@@ -0,0 +1,187 @@
+package rpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+var testFiles = []testFile{
+	{name: "a.txt", content: []byte("first")},
+	{name: "b.txt", content: []byte("second")},
+}
+
+func readTestPackFile(data []byte, crypto *AESCrypto) (*PackFile, error) {
+	return ReadPackFile("test.rpf", bytes.NewReader(data), int64(len(data)), crypto, nil)
+}
+
+func checkPackError(t *testing.T, err error, target error, entry int) {
+	t.Helper()
+
+	var packErr *PackError
+	if !errors.As(err, &packErr) || !errors.Is(err, target) {
+		t.Fatalf("error = %v, want PackError with %v", err, target)
+	}
+
+	if packErr.Entry != entry {
+		t.Errorf("entry = %d, want %d", packErr.Entry, entry)
+	}
+}
+
+func TestValidPack(t *testing.T) {
+	packFile, err := readTestPackFile(makeRPF7Pack(testFiles, nil), nil)
+	if err != nil {
+		t.Fatalf("ReadPackFile: %v", err)
+	}
+
+	for _, file := range testFiles {
+		packEntry, err := packFile.FindEntry(file.name)
+		if err != nil {
+			t.Fatalf("FindEntry(%q): %v", file.name, err)
+		}
+
+		content, err := packFile.ReadEntryContent(packEntry)
+		if err != nil {
+			t.Fatalf("ReadEntryContent: %v", err)
+		}
+
+		if !bytes.Equal(content, file.content) {
+			t.Errorf("content of %q = %q, want %q", file.name, content, file.content)
+		}
+	}
+}
+
+func TestTruncatedPack(t *testing.T) {
+	pack := makeRPF7Pack(testFiles, nil)
+
+	// Data of the last entry ends past the file
+	_, err := readTestPackFile(pack[:len(pack)-512+len(testFiles[1].content)-1], nil)
+	checkPackError(t, err, ErrDataRange, 2)
+
+	// TOC doesn't fit either
+	_, err = readTestPackFile(pack[:32], nil)
+	checkPackError(t, err, ErrTruncated, -1)
+}
+
+func TestDamagedTOC(t *testing.T) {
+	pack := makeRPF7Pack(testFiles, nil)
+	binary.LittleEndian.PutUint32(pack[16+12:], 5)
+
+	_, err := readTestPackFile(pack, nil)
+	checkPackError(t, err, ErrEntryRange, 0)
+
+	pack = makeRPF7Pack(testFiles, nil)
+	binary.LittleEndian.PutUint16(pack[32:], 0xFFF)
+
+	_, err = readTestPackFile(pack, nil)
+	checkPackError(t, err, ErrNameOffset, 1)
+}
+
+func TestNonASCIIName(t *testing.T) {
+	name := "caf\xe9.txt"
+
+	packFile, err := readTestPackFile(makeRPF7Pack([]testFile{{name: name, content: []byte("plain")}}, nil), nil)
+	if err != nil {
+		t.Fatalf("ReadPackFile: %v", err)
+	}
+
+	if _, err := packFile.FindEntry(name); err != nil {
+		t.Errorf("FindEntry(%q): %v", name, err)
+	}
+}
+
+func newTestCrypto(t *testing.T, seed byte) *AESCrypto {
+	t.Helper()
+
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = seed + byte(i)
+	}
+
+	crypto, err := NewAESCrypto(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return crypto
+}
+
+func TestWrongKey(t *testing.T) {
+	crypto := newTestCrypto(t, 1)
+	pack := makeRPF7Pack(testFiles, crypto.Key)
+
+	if _, err := readTestPackFile(pack, crypto); err != nil {
+		t.Fatalf("ReadPackFile with the right key: %v", err)
+	}
+
+	_, err := readTestPackFile(pack, newTestCrypto(t, 2))
+
+	var keyErr *KeyError
+	if !errors.Is(err, ErrWrongKey) || !errors.As(err, &keyErr) {
+		t.Errorf("ReadPackFile with a wrong key = %v, want %v", err, ErrWrongKey)
+	}
+}
+
+func TestTruncatedEncryptedPack(t *testing.T) {
+	crypto := newTestCrypto(t, 1)
+	pack := makeRPF7Pack(testFiles, crypto.Key)
+
+	_, err := readTestPackFile(pack[:len(pack)-512], crypto)
+	if errors.Is(err, ErrWrongKey) {
+		t.Fatalf("truncated pack is reported as a wrong key: %v", err)
+	}
+
+	checkPackError(t, err, ErrDataRange, 2)
+}
+
+func TestEncryptedNonASCIIName(t *testing.T) {
+	crypto := newTestCrypto(t, 1)
+	pack := makeRPF7Pack([]testFile{{name: "caf\xe9.txt", content: []byte("encrypted")}}, crypto.Key)
+
+	// Names of encrypted packs are always ASCII, garbage means a wrong key
+	if _, err := readTestPackFile(pack, crypto); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("ReadPackFile = %v, want %v", err, ErrWrongKey)
+	}
+}
+
+func TestNameShift(t *testing.T) {
+	files := []testFile{
+		{name: "a.txt", content: []byte("first")},
+		{name: "longer_name.json", content: []byte("second")},
+		{name: "c", content: []byte("third")},
+	}
+
+	for _, nameShift := range []uint{1, 3, 4} {
+		packFile, err := readTestPackFile(makeShiftedRPF7Pack(files, nil, nameShift), nil)
+		if err != nil {
+			t.Fatalf("ReadPackFile with shift %d: %v", nameShift, err)
+		}
+
+		if packFile.Header.NameShift != uint8(nameShift) {
+			t.Errorf("NameShift = %d, want %d", packFile.Header.NameShift, nameShift)
+		}
+
+		for i, file := range files {
+			name, err := packFile.GetEntryName(packFile.Entries[i+1])
+			if err != nil || name != file.name {
+				t.Errorf("name of entry %d with shift %d = %q, %v, want %q", i+1, nameShift, name, err, file.name)
+			}
+		}
+	}
+}
+
+func TestShiftedNameOffset(t *testing.T) {
+	pack := makeShiftedRPF7Pack(testFiles, nil, 3)
+	namesLength := binary.LittleEndian.Uint32(pack[8:]) & 0xFFFFFFF
+
+	// Fits into the names as a byte offset, but not once it's shifted
+	binary.LittleEndian.PutUint16(pack[32:], uint16(namesLength>>3+1))
+
+	if namesLength>>3+1 >= namesLength {
+		t.Fatal("name offset is out of names range without the shift")
+	}
+
+	_, err := readTestPackFile(pack, nil)
+	checkPackError(t, err, ErrNameOffset, 1)
+}
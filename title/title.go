@@ -0,0 +1,238 @@
+// Package title reads and decrypts title.rgl files of RGL
+package title
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/Disquse/RGLExtractor/internal/iostream"
+)
+
+var (
+	ErrInvalidMagic   = errors.New("title: invalid file magic")
+	ErrUnknownVersion = errors.New("title: unknown version")
+	ErrSizeMismatch   = errors.New("title: buffer size mismatch")
+	ErrBlockSize      = errors.New("title: data is not a multiple of the AES block size")
+	ErrWrongKey       = errors.New("title: decrypted content is not JSON, the key or IV is wrong")
+)
+
+const (
+	KeySize = 32
+	IVSize  = aes.BlockSize
+)
+
+// Title is an encrypted title.rgl file
+type Title struct {
+	Name    string
+	Magic   []byte
+	Version uint32
+	Length  uint32
+	Data    []byte
+}
+
+// ReadFromFile reads a title, its name is taken from the parent directory
+func ReadFromFile(filePath string) (*Title, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	title, err := ReadFromBuffer(content)
+	if err != nil {
+		return nil, err
+	}
+
+	// Get title name from file path
+	title.Name = getTitleFileName(filePath)
+
+	return title, nil
+}
+
+// ReadFromBuffer reads a title from title.rgl content
+func ReadFromBuffer(content []byte) (*Title, error) {
+	buffer := bytes.NewBuffer(content)
+	reader := iostream.NewReader(buffer)
+
+	magic := make([]byte, 4)
+	_, err := reader.Read(magic)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(magic) != "RGLM" {
+		return nil, ErrInvalidMagic
+	}
+
+	version, err := reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := reader.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
+
+	if version != 1 || length > uint32(len(content)) {
+		return nil, ErrUnknownVersion
+	}
+
+	// Hardcoded offset?
+	reader.SetOffset(0x50)
+
+	data := make([]byte, length)
+	size, err := reader.Read(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if size != int(length) {
+		return nil, ErrSizeMismatch
+	}
+
+	return &Title{
+		Name:    "",
+		Magic:   magic,
+		Version: version,
+		Length:  length,
+		Data:    data,
+	}, nil
+}
+
+func getTitleFileName(path string) string {
+	var parts []string
+	for {
+		dir, file := filepath.Split(path)
+		if file != "" {
+			parts = append([]string{file}, parts...)
+		}
+		if dir == "" || dir == path {
+			break
+		}
+		path = filepath.Clean(dir)
+	}
+
+	if len(parts) < 2 {
+		return ""
+	}
+
+	return parts[len(parts)-2]
+}
+
+// Decrypt returns the JSON content of a title, assuming the key and IV are
+// both empty. Use DecryptWithKey to know whether it worked
+func (title *Title) Decrypt() string {
+	content, _ := title.DecryptWithKey(make([]byte, KeySize), make([]byte, IVSize))
+	return content
+}
+
+// DecryptWithKey returns the JSON content of a title, ErrWrongKey is
+// returned if the key doesn't produce JSON. A wrong IV garbles only the
+// first block, so JSON is also looked for after it
+func (title *Title) DecryptWithKey(key []byte, iv []byte) (string, error) {
+	if len(title.Data)%aes.BlockSize != 0 {
+		return "", ErrBlockSize
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+
+	buffer := make([]byte, len(title.Data))
+	mode := cipher.NewCBCDecrypter(block, iv)
+	mode.CryptBlocks(buffer, title.Data)
+
+	content := trimContent(string(buffer))
+	if json.Valid([]byte(content)) {
+		return content, nil
+	}
+
+	if len(buffer) > aes.BlockSize {
+		if trimmed := trimContent(string(buffer[aes.BlockSize:])); json.Valid([]byte(trimmed)) {
+			return trimmed, nil
+		}
+	}
+
+	return content, ErrWrongKey
+}
+
+// Cuts everything before the first '{' and after the last '}'
+func trimContent(content string) string {
+	// FIXME: hacky trimming
+	for i := 0; i < len(content); i += 1 {
+		if content[i] == '{' {
+			content = content[i : len(content)-1]
+			break
+		}
+	}
+	for i := len(content) - 1; i > 0; i -= 1 {
+		if content[i] == '}' {
+			content = content[:i+1]
+			break
+		}
+	}
+
+	return content
+}
+
+// CheckKey quickly tells whether the key may be right. Only the last two
+// blocks are decrypted, they don't depend on the IV and have to end the JSON
+// with some text before the closing brace and only padding after it
+func (title *Title) CheckKey(key []byte) bool {
+	blockCount := len(title.Data) / aes.BlockSize
+	if blockCount < 2 || len(title.Data)%aes.BlockSize != 0 {
+		return false
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return false
+	}
+
+	// The first block needs the IV, so it's never checked
+	first := blockCount - 2
+	if first < 1 {
+		first = 1
+	}
+
+	buffer := make([]byte, aes.BlockSize)
+	textCount := 0
+	closed := -1
+
+	for i := first; i < blockCount; i++ {
+		block.Decrypt(buffer, title.Data[i*aes.BlockSize:])
+		previous := title.Data[(i-1)*aes.BlockSize : i*aes.BlockSize]
+
+		for j := range buffer {
+			char := buffer[j] ^ previous[j]
+
+			if char == '}' {
+				closed = i*aes.BlockSize + j
+			} else if closed < 0 && !isTextChar(char) {
+				return false
+			} else if closed < 0 {
+				textCount++
+			}
+		}
+	}
+
+	return closed >= 0 && textCount >= aes.BlockSize/2 && len(title.Data)-closed <= aes.BlockSize
+}
+
+func isTextChar(char byte) bool {
+	return (char >= 0x20 && char < 0x7F) || char == '\n' || char == '\r' || char == '\t'
+}